@@ -0,0 +1,301 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"misskey-reaction-cli/internal/audit"
+)
+
+// AccountConfig は accounts に指定する1つのアカウントの設定です。
+// 指定しなかった項目 (rulesなど) はトップレベルの設定を引き継ぎます。
+type AccountConfig struct {
+	// Name はログの接頭辞などに使う名前。省略時は account1, account2, ...
+	Name          string `yaml:"name"`
+	MisskeyConfig `yaml:",inline"`
+	Rules         []Rule `yaml:"rules"`
+	// StatePath, CooldownPath はアカウントごとに別のファイルを指定する
+	StatePath    string `yaml:"state_path"`
+	CooldownPath string `yaml:"cooldown_path"`
+}
+
+// accountConfig は名前付きの、アカウントごとに展開された設定です。
+type accountConfig struct {
+	name   string // accountsを使わない場合は空
+	config *Config
+}
+
+// accounts expands the accounts list into one config per account. Without
+// accounts, it returns the config itself as the only account.
+func (c *Config) accounts() ([]accountConfig, error) {
+	if len(c.Accounts) == 0 {
+		return []accountConfig{{config: c}}, nil
+	}
+	if c.StatePath != "" || c.CooldownPath != "" {
+		return nil, fmt.Errorf("accountsを使う場合、state_pathとcooldown_pathはアカウントごとに指定してください")
+	}
+
+	names := make(map[string]bool, len(c.Accounts))
+	accounts := make([]accountConfig, len(c.Accounts))
+	for i, a := range c.Accounts {
+		name := a.Name
+		if name == "" {
+			name = fmt.Sprintf("account%d", i+1)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("アカウント名 %s が重複しています", name)
+		}
+		names[name] = true
+
+		config := *c
+		config.Accounts = nil
+		config.Misskey = a.MisskeyConfig
+		if len(a.Rules) > 0 {
+			config.Rules = a.Rules
+		}
+		config.StatePath = a.StatePath
+		config.CooldownPath = a.CooldownPath
+		accounts[i] = accountConfig{name: name, config: &config}
+	}
+	return accounts, nil
+}
+
+// receiveFunc receives notes and calls the callback for each note until an
+// error occurs or stop is closed.
+type receiveFunc func(stop <-chan struct{}, noteCallback func(n note)) error
+
+// account は1つのアカウントの接続と、ノートを処理するbotです。
+type account struct {
+	name   string
+	logger *slog.Logger
+	// conn は /readyz で返す接続状態
+	conn  *connState
+	pause *pauseState
+	// rec は受信したフレームの記録先 (nilの場合は記録しない)
+	rec *frameRecorder
+
+	// bot, config, receive は設定の再読み込みで差し替わる
+	mu    sync.RWMutex
+	bot   *bot
+	queue *noteQueue
+	// config は接続に使っている設定。ルールなどの再読み込みした設定はbotが持つ
+	config  *Config
+	receive receiveFunc
+	// stopReceive を閉じると受信を止め、receive で接続し直す
+	stopReceive chan struct{}
+}
+
+// validateAccountConfig checks the settings that every account needs.
+func validateAccountConfig(config *Config) error {
+	if config.Misskey.URL == "" {
+		return fmt.Errorf("エラー: 設定ファイルにMisskeyのURLが指定されていません")
+	}
+	if config.Misskey.Token == "" {
+		return fmt.Errorf("エラー: 設定ファイルにMisskeyのAPIトークンが指定されていません")
+	}
+	if len(config.Rules) == 0 && config.Reaction.MatchText == "" {
+		return fmt.Errorf("エラー: 設定ファイルにリアクション対象の文字列(match_text)が指定されていません")
+	}
+	return nil
+}
+
+// newAccount validates the config and prepares the bot and the note receiver.
+// The decisions of the bot are recorded in auditLog and the received frames
+// in rec unless they are nil.
+func newAccount(name string, config *Config, logger *slog.Logger, auditLog *audit.Log, rec *frameRecorder) (*account, error) {
+	if err := validateAccountConfig(config); err != nil {
+		return nil, err
+	}
+
+	b, err := newBot(config, logger)
+	if err != nil {
+		return nil, err
+	}
+	pause := newPauseState()
+	b.account = name
+	b.pause = pause
+	b.auditLog = auditLog
+	conn := &connState{account: name}
+	rec = rec.forAccount(name)
+	receive, err := noteReceiver(config, logger, conn, rec)
+	if err != nil {
+		return nil, err
+	}
+	return &account{name: name, logger: logger, conn: conn, pause: pause, rec: rec, bot: b, config: config, receive: receive}, nil
+}
+
+// connection returns the config the account connects with.
+func (a *account) connection() *Config {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.config
+}
+
+// reconnect switches to a receiver created from a reloaded config whose
+// connection settings differ, closing the current connection so that run
+// connects again right away.
+func (a *account) reconnect(config *Config, receive receiveFunc) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.config, a.receive = config, receive
+	if a.stopReceive != nil {
+		close(a.stopReceive)
+		a.stopReceive = nil
+	}
+}
+
+// currentBot returns the bot that handles new notes.
+func (a *account) currentBot() *bot {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.bot
+}
+
+// replaceBot switches to a bot created from a reloaded config. The new bot
+// takes over the state of the old one; notes being handled by the old bot
+// finish with the old rules.
+func (a *account) replaceBot(b *bot) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	b.inherit(a.bot)
+	a.bot.close()
+	a.bot = b
+}
+
+// pending returns the notes waiting in the queue.
+func (a *account) pending() []note {
+	a.mu.RLock()
+	queue := a.queue
+	a.mu.RUnlock()
+	if queue == nil {
+		return nil
+	}
+	return queue.pending()
+}
+
+// run receives notes until an error occurs, reconnecting when
+// reconnect_interval is set. The received notes are handled in order by a
+// worker that keeps running across reconnections, so that a reconnection
+// does not wait for the queued notes.
+func (a *account) run() error {
+	queue := newNoteQueue(noteQueueCapacity, func(depth int) {
+		queueDepth.Set(float64(depth), a.name)
+	})
+	a.mu.Lock()
+	a.queue = queue
+	a.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			n, ok := queue.pop()
+			if !ok {
+				return
+			}
+			a.currentBot().handleNote(n)
+		}
+	}()
+	// 終了する前に、受信済みのノートと実行中のコマンドを処理し終える
+	defer func() {
+		queue.close()
+		<-done
+		a.currentBot().execs.Wait()
+		a.saveState()
+	}()
+
+	for {
+		err := a.receiveNotes(queue)
+		// 再読み込みで接続の設定が変わった場合は、キューの処理を待たずに接続し直す
+		if errors.Is(err, errReconnect) {
+			a.logger.Info("接続の設定が変わったため再接続します", "queued", queue.len())
+			reconnects.Inc(a.name)
+			continue
+		}
+
+		interval := a.currentBot().config.ReconnectInterval
+		if interval <= 0 {
+			return err
+		}
+		a.logger.Error("切断されたため再接続します", append([]any{"reconnect_interval", interval.String()}, errorAttrs(err)...)...)
+		time.Sleep(interval)
+		reconnects.Inc(a.name)
+	}
+}
+
+// errReconnect is returned by receiveNotes when the connection was closed
+// to connect with reloaded settings.
+var errReconnect = errors.New("接続の設定が変わりました")
+
+// receiveNotes connects once and pushes the received notes to the queue
+// until the connection fails or is closed by reconnect.
+func (a *account) receiveNotes(queue *noteQueue) error {
+	// 自分のノートを除外できるよう、ノートを受信する前に自分のユーザーIDを確かめる
+	b := a.currentBot()
+	selfID, err := b.self()
+	if err != nil {
+		return err
+	}
+	if a.connection().Mode != modePoll {
+		if err := a.rec.self(selfID); err != nil {
+			a.logger.Warn("受信したフレームの記録に失敗しました", errorAttrs(err)...)
+		}
+	}
+
+	// 接続していなかった間のノートを並行して取得し、受信したノートと同じキューに入れる
+	// (重複はhandleNoteで除外される)。起点はノートを受信する前に決めておく
+	if b.config.Backfill.Enabled {
+		go b.backfill(b.state.last(), queue.push)
+	}
+
+	// ノートを受信してキューに追加する
+	a.mu.Lock()
+	stop := make(chan struct{})
+	a.stopReceive = stop
+	receive := a.receive
+	a.mu.Unlock()
+	err = receive(stop, queue.push)
+	a.saveState()
+	if stopped(stop) {
+		return errReconnect
+	}
+	return err
+}
+
+// saveState writes the state of the current bot to its file.
+func (a *account) saveState() {
+	b := a.currentBot()
+	if err := b.state.save(b.now(), true); err != nil {
+		a.logger.Warn("状態ファイルの保存に失敗しました", errorAttrs(err)...)
+	}
+}
+
+// superviseAccounts runs the accounts concurrently. An account that stops
+// with an error is logged without stopping the others; the errors are
+// returned once every account has stopped.
+func superviseAccounts(accounts []*account) error {
+	errs := make([]error, len(accounts))
+	var wg sync.WaitGroup
+	for i, a := range accounts {
+		wg.Add(1)
+		go func(i int, a *account) {
+			defer wg.Done()
+			if err := a.run(); err != nil {
+				a.logger.Error("アカウントを停止しました", errorAttrs(err)...)
+				errs[i] = fmt.Errorf("アカウント %s: %w", a.name, err)
+			}
+		}(i, a)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// accountLogger returns a logger that adds the account name to each event.
+func accountLogger(logger *slog.Logger, name string) *slog.Logger {
+	if name == "" {
+		return logger
+	}
+	return logger.With(logKeyAccount, name)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestConfigAccounts(t *testing.T) {
+	var config Config
+	err := yaml.Unmarshal([]byte(`
+rules:
+  - match_text: "hello"
+max_note_age: "10m"
+accounts:
+  - name: "main"
+    url: "https://a.example.com"
+    token: "tokenA"
+    channels: ["homeTimeline", "localTimeline"]
+    state_path: "a.json"
+  - url: "https://b.example.com"
+    token: "tokenB"
+    rules:
+      - match_text: "bye"
+`), &config)
+	if err != nil {
+		t.Fatalf("パースに失敗しました: %v", err)
+	}
+
+	accounts, err := config.accounts()
+	if err != nil {
+		t.Fatalf("展開に失敗しました: %v", err)
+	}
+	if len(accounts) != 2 || accounts[0].name != "main" || accounts[1].name != "account2" {
+		t.Fatalf("main と account2 を期待しましたが、実際: %+v", accounts)
+	}
+	a, b := accounts[0].config, accounts[1].config
+	if a.Misskey.URL != "https://a.example.com" || a.Misskey.Token != "tokenA" || len(a.Misskey.channels()) != 2 || a.StatePath != "a.json" {
+		t.Errorf("アカウントの接続設定が反映されていません: %+v", a)
+	}
+	if a.Rules[0].MatchText != "hello" || b.Rules[0].MatchText != "bye" {
+		t.Errorf("rulesの省略時はトップレベルを引き継ぐことを期待しましたが、実際: %+v, %+v", a.Rules, b.Rules)
+	}
+	if a.MaxNoteAge != 10*time.Minute || b.MaxNoteAge != 10*time.Minute {
+		t.Error("共通の設定を引き継ぐことを期待しました")
+	}
+}
+
+func TestConfigAccounts_Error(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Config
+		expected string
+	}{
+		{"名前の重複", Config{Accounts: []AccountConfig{{Name: "a"}, {Name: "a"}}}, "アカウント名 a が重複しています"},
+		{"共通の状態ファイル", Config{StatePath: "state.json", Accounts: []AccountConfig{{Name: "a"}}}, "アカウントごとに指定してください"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.config.accounts(); err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("エラー '%s' を期待しましたが、実際: %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestSuperviseAccounts(t *testing.T) {
+	alive := newMockMisskey(t, `{"emojis":[]}`)
+	alive.stream = []note{{ID: "note1", Text: "hello"}}
+	closed := httptest.NewServer(nil)
+	closed.Close()
+
+	var accounts []*account
+	var logs []*bytes.Buffer
+	for _, tc := range []struct{ name, url string }{{"alive", alive.URL}, {"broken", closed.URL}} {
+		var logBuffer bytes.Buffer
+		a, err := newAccount(tc.name, testConfig(tc.url, Rule{MatchText: "hello"}), accountLogger(slog.New(slog.NewTextHandler(&logBuffer, nil)), tc.name), nil, nil)
+		if err != nil {
+			t.Fatalf("アカウントの作成に失敗しました: %v", err)
+		}
+		a.bot.delay = func() time.Duration { return 0 }
+		accounts = append(accounts, a)
+		logs = append(logs, &logBuffer)
+	}
+
+	err := superviseAccounts(accounts)
+
+	// 一方が接続できなくても、もう一方はノートを処理する
+	if reactions := alive.sentReactions(); len(reactions) != 1 || reactions[0].NoteID != "note1" {
+		t.Errorf("note1 へのリアクションを期待しましたが、実際: %+v", reactions)
+	}
+	if err == nil || !strings.Contains(err.Error(), "アカウント broken: 自分のアカウントの情報を取得できませんでした") {
+		t.Errorf("broken のエラーを期待しましたが、実際: %v", err)
+	}
+	assertLogLine(t, logs[0], "account=alive", "note_id=note1")
+	assertLogLine(t, logs[1], "level=ERROR", "アカウントを停止しました", "account=broken")
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"text/template"
+	"time"
+
+	"misskey-reaction-cli/internal/audit"
+)
+
+// アクションの種類
+const (
+	actionReaction = "reaction"
+	actionRenote   = "renote"
+	actionQuote    = "quote"
+	actionReply    = "reply"
+	actionFavorite = "favorite"
+	actionClip     = "clip"
+	actionWebhook  = "webhook"
+	actionExec     = "exec"
+)
+
+// Action はルールに一致したノートに対して行う操作です。
+type Action struct {
+	// Type は reaction, renote, quote, reply, favorite, clip, webhook, exec のいずれか
+	Type string `yaml:"type"`
+	// Text は quote と reply の本文のテンプレート (Goのtext/template)
+	Text string `yaml:"text"`
+	// ClipID は clip でノートを追加するクリップのID
+	ClipID string `yaml:"clip_id"`
+	// Visibility は renote, quote, reply の公開範囲 (public, home, followers)。
+	// 省略時、quote と reply は元のノートの公開範囲、renote はMisskeyの既定値
+	Visibility string `yaml:"visibility"`
+	// URL, Headers, Secret は webhook の送信先、追加のヘッダー、HMAC署名の鍵
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+	Secret  string            `yaml:"secret"`
+	// Timeout は webhook と exec のタイムアウト
+	Timeout time.Duration `yaml:"timeout"`
+	// Command は exec で実行するコマンドと引数
+	Command []string `yaml:"command"`
+	// MaxConcurrency は exec のコマンドを同時に実行する数の上限。省略時は1
+	MaxConcurrency int `yaml:"max_concurrency"`
+	// UseOutputAsReaction を有効にすると、exec のコマンドが標準出力に出した絵文字を以降のリアクションに使う
+	UseOutputAsReaction bool `yaml:"use_output_as_reaction"`
+
+	tmpl  *template.Template
+	slots chan struct{} // exec の同時実行数の制限
+}
+
+// RetryConfig はAPI呼び出しが一時的なエラーで失敗したときの再試行の設定です。
+type RetryConfig struct {
+	// MaxAttempts は最初の呼び出しを含めた最大試行回数。省略時は1 (再試行しない)
+	MaxAttempts int `yaml:"max_attempts"`
+	// Interval は最初の再試行までの待ち時間。再試行のたびに2倍になる。省略時は5秒
+	Interval time.Duration `yaml:"interval"`
+}
+
+// defaultRetryInterval は retry.interval の省略時の値です。
+const defaultRetryInterval = 5 * time.Second
+
+// prepareActions validates the actions of the rule. A rule without actions
+// adds a reaction.
+func (r *Rule) prepareActions() error {
+	if len(r.Actions) == 0 {
+		r.Actions = []Action{{Type: actionReaction}}
+		return nil
+	}
+	for i := range r.Actions {
+		action := &r.Actions[i]
+		switch action.Type {
+		case actionReaction, actionRenote, actionFavorite:
+		case actionQuote, actionReply:
+			if action.Text == "" {
+				return fmt.Errorf("%d番目のアクション %s にtextが指定されていません", i+1, action.Type)
+			}
+			tmpl, err := parseTextTemplate(action.Text)
+			if err != nil {
+				return fmt.Errorf("%d番目のアクション %s: %w", i+1, action.Type, err)
+			}
+			action.tmpl = tmpl
+		case actionClip:
+			if action.ClipID == "" {
+				return fmt.Errorf("%d番目のアクション clip にclip_idが指定されていません", i+1)
+			}
+		case actionWebhook:
+			if err := checkWebhook(*action); err != nil {
+				return fmt.Errorf("%d番目のアクション: %w", i+1, err)
+			}
+		case actionExec:
+			if err := checkExec(action); err != nil {
+				return fmt.Errorf("%d番目のアクション: %w", i+1, err)
+			}
+		default:
+			return fmt.Errorf("%d番目のアクションの種類 %q は不正です", i+1, action.Type)
+		}
+		switch action.Visibility {
+		case "", "public", "home", "followers":
+		default:
+			return fmt.Errorf("%d番目のアクションのvisibility %q は不正です", i+1, action.Visibility)
+		}
+	}
+	return nil
+}
+
+// hasAction reports whether the rule has an action of the type.
+func (r *Rule) hasAction(actionType string) bool {
+	for _, action := range r.Actions {
+		if action.Type == actionType {
+			return true
+		}
+	}
+	return false
+}
+
+// noteCreateRequest は notes/create のリクエストボディです。
+type noteCreateRequest struct {
+	Text       string `json:"text,omitempty"`
+	RenoteID   string `json:"renoteId,omitempty"`
+	ReplyID    string `json:"replyId,omitempty"`
+	Visibility string `json:"visibility,omitempty"`
+	// VisibleUserIDs は公開範囲がspecifiedのときにノートを見られるユーザー
+	VisibleUserIDs []string `json:"visibleUserIds,omitempty"`
+}
+
+// createNote posts a note, renote, quote or reply.
+func createNote(misskeyURL, token string, req noteCreateRequest) error {
+	return callAPI(misskeyURL, "notes/create", token, req, nil)
+}
+
+// createFavorite adds the note to the favorites.
+func createFavorite(misskeyURL, noteID, token string) error {
+	return callAPI(misskeyURL, "notes/favorites/create", token, map[string]string{"noteId": noteID}, nil)
+}
+
+// addNoteToClip adds the note to the clip.
+func addNoteToClip(misskeyURL, clipID, noteID, token string) error {
+	return callAPI(misskeyURL, "clips/add-note", token, map[string]string{"clipId": clipID, "noteId": noteID}, nil)
+}
+
+// performAction runs one action for the note and logs the result. It returns
+// false when the remaining actions must be skipped because the note is gone.
+func (b *bot) performAction(n note, rule *Rule, action Action, reaction string) bool {
+	logger := b.noteLogger(n, rule).With(logKeyAction, action.Type)
+	var call func() error
+	url, token := b.config.Misskey.URL, b.config.Misskey.Token
+	switch action.Type {
+	case actionReaction:
+		logger = logger.With(logKeyEmoji, reaction)
+		call = func() error { return createReaction(url, n.ID, reaction, token) }
+	case actionRenote:
+		call = func() error {
+			return createNote(url, token, noteCreateRequest{RenoteID: n.ID, Visibility: action.Visibility})
+		}
+	case actionQuote, actionReply:
+		text, err := rule.renderText(action, n)
+		if err != nil {
+			logger.Warn("スキップ: 本文のテンプレートを展開できません", errorAttrs(err)...)
+			b.auditAction(n, rule, action, "", audit.ResultSkipped, err)
+			return true
+		}
+		req := noteCreateRequest{Text: text, Visibility: action.Visibility}
+		if req.Visibility == "" {
+			req.Visibility, req.VisibleUserIDs = inheritVisibility(n)
+		}
+		if action.Type == actionQuote {
+			req.RenoteID = n.ID
+		} else {
+			req.ReplyID = n.ID
+		}
+		logger = logger.With("text", text)
+		call = func() error { return createNote(url, token, req) }
+	case actionFavorite:
+		call = func() error { return createFavorite(url, n.ID, token) }
+	case actionClip:
+		logger = logger.With("clip_id", action.ClipID)
+		call = func() error { return addNoteToClip(url, action.ClipID, n.ID, token) }
+	case actionWebhook:
+		logger = logger.With("webhook_host", webhookHost(action.URL))
+		payload := b.payload(n, rule)
+		call = func() error { return sendWebhook(action, payload) }
+	}
+
+	if b.config.DryRun {
+		logger.Info("ドライラン: アクションを実行します")
+		b.auditAction(n, rule, action, reaction, audit.ResultDryRun, nil)
+		return true
+	}
+	start := time.Now()
+	err := b.withRetry(logger, call)
+	logger = logger.With(logKeyLatency, time.Since(start).Round(time.Millisecond).String())
+	if action.Type == actionReaction {
+		if err == nil {
+			reactionsSent.Inc(b.account, rule.Name)
+		} else {
+			reactionsFailed.Inc(b.account, errorCode(err))
+		}
+	}
+	b.auditAction(n, rule, action, reaction, actionResult(err), err)
+	switch {
+	case err == nil:
+		logger.Info("アクションを実行しました")
+	case isAPIError(err, "ALREADY_REACTED"):
+		logger.Info("スキップ: 既にリアクション済みでした", errorAttrs(err)...)
+	case isAPIError(err, "ALREADY_FAVORITED"):
+		logger.Info("スキップ: 既にお気に入りに追加されていました", errorAttrs(err)...)
+	case isAPIError(err, "ALREADY_CLIPPED"):
+		logger.Info("スキップ: 既にクリップに追加されていました", errorAttrs(err)...)
+	case isAPIError(err, "NO_SUCH_NOTE"):
+		logger.Info("スキップ: ノートが削除されていました", errorAttrs(err)...)
+		return false
+	default:
+		logger.Error("アクションの実行に失敗しました", errorAttrs(err)...)
+	}
+	return true
+}
+
+// inheritVisibility returns the visibility of a reply or quote to the note, so
+// that it is not shown more widely than the original note.
+func inheritVisibility(n note) (string, []string) {
+	if n.Visibility != "specified" {
+		return n.Visibility, nil
+	}
+	userID := n.authorID()
+	if userID == "" {
+		return "specified", nil
+	}
+	return "specified", []string{userID}
+}
+
+// withRetry calls the API and retries temporary failures according to the
+// retry config, doubling the wait each time.
+func (b *bot) withRetry(logger *slog.Logger, call func() error) error {
+	maxAttempts := b.config.Retry.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
+	wait := b.config.Retry.Interval
+	if wait <= 0 {
+		wait = defaultRetryInterval
+	}
+	for attempt := 1; ; attempt++ {
+		err := call()
+		if err == nil || attempt >= maxAttempts || !isTemporary(err) {
+			return err
+		}
+		logger.Warn("API呼び出しに失敗したため再試行します", append([]any{"attempt", attempt, "max_attempts", maxAttempts, "wait", wait.String()}, errorAttrs(err)...)...)
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+// isTemporary reports whether the API call may succeed when retried: network
+// errors, rate limiting and server errors.
+func isTemporary(err error) bool {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr.Status == 429 || apiErr.Status >= 500
+	}
+	return true
+}
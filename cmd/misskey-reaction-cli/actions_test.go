@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"misskey-reaction-cli/internal/audit"
+)
+
+func TestPrepareActions_Error(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     Rule
+		expected string
+	}{
+		{"不正な種類", Rule{MatchText: "a", Actions: []Action{{Type: "boost"}}}, `アクションの種類 "boost" は不正です`},
+		{"返信の本文なし", Rule{MatchText: "a", Actions: []Action{{Type: actionReply}}}, "reply にtextが指定されていません"},
+		{"クリップIDなし", Rule{MatchText: "a", Actions: []Action{{Type: actionClip}}}, "clip_idが指定されていません"},
+		{"不正な公開範囲", Rule{MatchText: "a", Actions: []Action{{Type: actionRenote, Visibility: "specified"}}}, `visibility "specified" は不正です`},
+		{"テンプレートの構文", Rule{MatchText: "a", Actions: []Action{{Type: actionQuote, Text: "{{.Text"}}}, "テンプレートのパースに失敗しました"},
+		{"存在しないフィールド", Rule{MatchText: "a", Actions: []Action{{Type: actionReply, Text: "{{.Usr.Username}}"}}}, "テンプレートが不正です"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := prepareRules([]Rule{tt.rule}); err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("エラー '%s' を期待しましたが、実際: %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestBotHandleNote_Actions(t *testing.T) {
+	server := newMockMisskey(t, `{"emojis":[]}`)
+	b, logBuffer := newTestBot(t, testConfig(server.URL, Rule{
+		MatchText: `(?P<item>.+)をください`,
+		MatchType: "regex",
+		Emoji:     EmojiSet{{Emoji: "🎁"}},
+		Actions: []Action{
+			{Type: actionReaction},
+			{Type: actionRenote, Visibility: "home"},
+			{Type: actionQuote, Text: `{{index .Captures "1"}} です`},
+			{Type: actionReply, Text: `@{{.User.Username}} {{.Captures.item}} をどうぞ`},
+			{Type: actionFavorite},
+			{Type: actionClip, ClipID: "clip1"},
+		},
+	}))
+
+	b.handleNote(note{ID: "note1", Text: "りんごをください", User: noteUser{ID: "u1", Username: "alice"}})
+
+	if reactions := server.sentReactions(); len(reactions) != 1 || reactions[0].Reaction != "🎁" {
+		t.Errorf("🎁 のリアクションを期待しましたが、実際: %+v", reactions)
+	}
+	expected := []apiCall{
+		{"notes/create", map[string]string{"renoteId": "note1", "visibility": "home"}},
+		{"notes/create", map[string]string{"renoteId": "note1", "text": "りんご です"}},
+		{"notes/create", map[string]string{"replyId": "note1", "text": "@alice りんご をどうぞ"}},
+		{"notes/favorites/create", map[string]string{"noteId": "note1"}},
+		{"clips/add-note", map[string]string{"clipId": "clip1", "noteId": "note1"}},
+	}
+	if calls := server.apiCalls(); !reflect.DeepEqual(calls, expected) {
+		t.Errorf("期待値: %+v, 実際: %+v", expected, calls)
+	}
+	assertLogLine(t, logBuffer, "アクションを実行しました", "note_id=note1", "rule=rule1", "user=@alice", "action=reply", `text="@alice りんご をどうぞ"`)
+}
+
+func TestBotHandleNote_ActionsWithoutReaction(t *testing.T) {
+	server := newMockMisskey(t, `{"emojis":[]}`)
+	b, _ := newTestBot(t, testConfig(server.URL, Rule{MatchText: "hello", Actions: []Action{{Type: actionFavorite}}}))
+
+	// リアクションしないルールは、既にリアクションがあっても実行する
+	b.handleNote(note{ID: "note1", Text: "hello", MyReaction: "👍"})
+
+	if reactions := server.sentReactions(); len(reactions) != 0 {
+		t.Errorf("リアクションしないことを期待しましたが、実際: %+v", reactions)
+	}
+	if calls := server.apiCalls(); len(calls) != 1 || calls[0].Endpoint != "notes/favorites/create" {
+		t.Errorf("お気に入りへの追加を期待しましたが、実際: %+v", calls)
+	}
+}
+
+func TestAccountRun_IgnoresOwnReply(t *testing.T) {
+	server := newMockMisskey(t, `{"emojis":[]}`)
+	server.stream = []note{{ID: "note1", Text: "今日もおつかれ", User: noteUser{ID: "u1", Username: "alice"}}}
+	server.echo = make(chan note, 1)
+	// 返信の本文がルール自身のmatch_textに一致する
+	config := testConfig(server.URL, Rule{Name: "otsukare", MatchText: "おつかれ", Actions: []Action{{Type: actionReply, Text: "@{{.User.Username}} おつかれさまです！"}}})
+	var logBuffer, auditBuffer bytes.Buffer
+	a, err := newAccount("", config, slog.New(slog.NewTextHandler(&logBuffer, nil)), audit.New(&auditBuffer), nil)
+	if err != nil {
+		t.Fatalf("アカウントの作成に失敗しました: %v", err)
+	}
+	a.bot.delay = func() time.Duration { return 0 }
+
+	a.run()
+
+	expected := []apiCall{{"notes/create", map[string]string{"replyId": "note1", "text": "@alice おつかれさまです！"}}}
+	if calls := server.apiCalls(); !reflect.DeepEqual(calls, expected) {
+		t.Errorf("返信は1回だけのはずですが、実際: %+v", calls)
+	}
+	records, err := audit.Read(&auditBuffer)
+	if err != nil {
+		t.Fatalf("監査ログを読み込めませんでした: %v", err)
+	}
+	found := false
+	for _, r := range records {
+		if r.NoteID == "created1" && r.Event == audit.EventSkip && r.Reason == skipSelf {
+			found = true
+		}
+		if r.NoteID == "created1" && r.Event == audit.EventRule {
+			t.Errorf("自分のノートでルールを判定しています: %+v", r)
+		}
+	}
+	if !found {
+		t.Errorf("自分のノートのスキップが監査ログに記録されていません: %+v", records)
+	}
+}
+
+func TestBotHandleNote_DryRun(t *testing.T) {
+	server := newMockMisskey(t, `{"emojis":[]}`)
+	config := testConfig(server.URL, Rule{MatchText: "hello", Actions: []Action{{Type: actionReaction}, {Type: actionRenote}}})
+	config.DryRun = true
+	b, logBuffer := newTestBot(t, config)
+
+	b.handleNote(note{ID: "note1", Text: "hello"})
+
+	if len(server.sentReactions()) != 0 || len(server.apiCalls()) != 0 {
+		t.Errorf("APIを呼び出さないことを期待しましたが、実際: %+v, %+v", server.sentReactions(), server.apiCalls())
+	}
+	assertLogLine(t, logBuffer, "ドライラン: アクションを実行します", "note_id=note1", "action=reaction", "emoji=👍")
+	assertLogLine(t, logBuffer, "ドライラン: アクションを実行します", "note_id=note1", "action=renote")
+}
+
+func TestBotHandleNote_Retry(t *testing.T) {
+	tests := []struct {
+		name         string
+		serverErrors int
+		expected     int
+	}{
+		{"再試行で成功", 2, 1},
+		{"再試行の上限", 3, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newMockMisskey(t, `{"emojis":[]}`)
+			server.serverErrors = tt.serverErrors
+			config := testConfig(server.URL, Rule{MatchText: "hello"})
+			config.Retry = RetryConfig{MaxAttempts: 3, Interval: time.Millisecond}
+			b, logBuffer := newTestBot(t, config)
+
+			b.handleNote(note{ID: "note1", Text: "hello"})
+
+			if reactions := server.sentReactions(); len(reactions) != tt.expected {
+				t.Errorf("%d 件のリアクションを期待しましたが、実際: %+v", tt.expected, reactions)
+			}
+			assertLogLine(t, logBuffer, "level=WARN", "API呼び出しに失敗したため再試行します", "attempt=2", "max_attempts=3")
+		})
+	}
+}
+
+func TestIsTemporary(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{&apiError{Code: "NO_SUCH_NOTE", Status: 400}, false},
+		{&apiError{Code: "RATE_LIMIT_EXCEEDED", Status: 429}, true},
+		{&apiError{Status: 502}, true},
+	}
+	for _, tt := range tests {
+		if got := isTemporary(tt.err); got != tt.expected {
+			t.Errorf("%v: 期待値: %v, 実際: %v", tt.err, tt.expected, got)
+		}
+	}
+}
+
+func TestInheritVisibility(t *testing.T) {
+	tests := []struct {
+		name         string
+		note         note
+		visibility   string
+		visibleUsers []string
+	}{
+		{"公開", note{Visibility: "public"}, "public", nil},
+		{"フォロワー限定", note{Visibility: "followers"}, "followers", nil},
+		{"指定ユーザー", note{Visibility: "specified", User: noteUser{ID: "u1"}}, "specified", []string{"u1"}},
+		{"不明", note{}, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			visibility, users := inheritVisibility(tt.note)
+			if visibility != tt.visibility || !reflect.DeepEqual(users, tt.visibleUsers) {
+				t.Errorf("期待値: %s %v, 実際: %s %v", tt.visibility, tt.visibleUsers, visibility, users)
+			}
+		})
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// AdminConfig はメトリクスや管理APIを提供する管理用HTTPサーバーの設定です。
+type AdminConfig struct {
+	// Listen は待ち受けるアドレス (例: 127.0.0.1:9100)。省略時は起動しない
+	Listen string `yaml:"listen"`
+	// Socket は管理APIを待ち受けるUnixソケットのパス
+	Socket string `yaml:"socket"`
+	// Token は管理APIの認証に使うトークン。省略時、管理APIはUnixソケットでのみ提供する
+	Token string `yaml:"token"`
+	// IdleTimeout はこの時間メッセージを受信していない場合に /readyz を失敗させる。省略時は10分、負の値で無効
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+}
+
+// 管理APIのレスポンス
+type (
+	accountStatus struct {
+		Account    string       `json:"account"`
+		Paused     bool         `json:"paused"`
+		QueueDepth int          `json:"queue_depth"`
+		Rules      []ruleStatus `json:"rules"`
+	}
+	ruleStatus struct {
+		Name      string `json:"name"`
+		Paused    bool   `json:"paused"`
+		Matches   int    `json:"matches"`
+		Reactions int    `json:"reactions"`
+	}
+	queuedNote struct {
+		Account string `json:"account"`
+		ID      string `json:"id"`
+		User    string `json:"user"`
+		Channel string `json:"channel"`
+		Text    string `json:"text"`
+	}
+	apiErrorResponse struct {
+		Error string `json:"error"`
+	}
+)
+
+// newAdminHandler returns the handler of the admin HTTP server. The admin
+// API under /api/ is served only when api is true.
+func newAdminHandler(config AdminConfig, a *app, api bool) http.Handler {
+	idleTimeout := config.IdleTimeout
+	if idleTimeout == 0 {
+		idleTimeout = defaultIdleTimeout
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metricsRegistry.Handler())
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		var reasons []string
+		for _, acc := range a.accounts {
+			if ok, reason := acc.conn.ready(time.Now(), idleTimeout); !ok {
+				if acc.name != "" {
+					reason = fmt.Sprintf("アカウント %s: %s", acc.name, reason)
+				}
+				reasons = append(reasons, reason)
+			}
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if len(reasons) > 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, strings.Join(reasons, "\n"))
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	if !api {
+		return mux
+	}
+
+	auth := func(h http.HandlerFunc) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if config.Token != "" {
+				token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+				if subtle.ConstantTimeCompare([]byte(token), []byte(config.Token)) != 1 {
+					writeJSON(w, http.StatusUnauthorized, apiErrorResponse{"トークンが正しくありません"})
+					return
+				}
+			}
+			h(w, r)
+		})
+	}
+	mux.Handle("GET /api/rules", auth(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, a.status())
+	}))
+	mux.Handle("GET /api/queue", auth(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, a.queued())
+	}))
+	mux.Handle("POST /api/pause", auth(func(w http.ResponseWriter, r *http.Request) {
+		a.handlePause(w, r, true)
+	}))
+	mux.Handle("POST /api/resume", auth(func(w http.ResponseWriter, r *http.Request) {
+		a.handlePause(w, r, false)
+	}))
+	mux.Handle("POST /api/reload", auth(func(w http.ResponseWriter, r *http.Request) {
+		if err := a.tryReload(); err != nil {
+			writeJSON(w, http.StatusUnprocessableEntity, apiErrorResponse{err.Error()})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	return mux
+}
+
+// status returns the pause state and the counters of every rule.
+func (a *app) status() []accountStatus {
+	statuses := make([]accountStatus, len(a.accounts))
+	for i, acc := range a.accounts {
+		b := acc.currentBot()
+		s := accountStatus{Account: acc.name, Paused: acc.pause.allPaused(), QueueDepth: len(acc.pending())}
+		for _, rule := range b.rules {
+			s.Rules = append(s.Rules, ruleStatus{
+				Name:      rule.Name,
+				Paused:    acc.pause.isPaused(rule.Name),
+				Matches:   int(ruleMatches.Value(acc.name, rule.Name)),
+				Reactions: int(reactionsSent.Value(acc.name, rule.Name)),
+			})
+		}
+		statuses[i] = s
+	}
+	return statuses
+}
+
+// queued returns the notes waiting to be handled.
+func (a *app) queued() []queuedNote {
+	notes := []queuedNote{}
+	for _, acc := range a.accounts {
+		for _, n := range acc.pending() {
+			user := n.User.acct()
+			if n.User.Username == "" {
+				user = n.UserID
+			}
+			notes = append(notes, queuedNote{Account: acc.name, ID: n.ID, User: user, Channel: n.channel, Text: truncate(100, n.Text)})
+		}
+	}
+	return notes
+}
+
+// handlePause pauses or resumes the rule given by the rule query parameter,
+// or the whole bot without it, in the account given by the account query
+// parameter or in every account.
+func (a *app) handlePause(w http.ResponseWriter, r *http.Request, paused bool) {
+	rule, name := r.URL.Query().Get("rule"), r.URL.Query().Get("account")
+	targets := a.accounts
+	if r.URL.Query().Has("account") {
+		acc := a.findAccount(name)
+		if acc == nil {
+			writeJSON(w, http.StatusNotFound, apiErrorResponse{fmt.Sprintf("アカウント %s は存在しません", name)})
+			return
+		}
+		targets = []*account{acc}
+	}
+	if rule != "" && !hasRule(targets, rule) {
+		writeJSON(w, http.StatusNotFound, apiErrorResponse{fmt.Sprintf("ルール %s は存在しません", rule)})
+		return
+	}
+
+	for _, acc := range targets {
+		acc.pause.set(rule, paused)
+	}
+	msg := "一時停止しました"
+	if !paused {
+		msg = "再開しました"
+	}
+	a.logger.Info("管理API: "+msg, logKeyRule, rule, logKeyAccount, name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// hasRule reports whether any of the accounts has the rule.
+func hasRule(accounts []*account, name string) bool {
+	for _, acc := range accounts {
+		for _, rule := range acc.currentBot().rules {
+			if rule.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// startAdmin starts the admin HTTP server on the TCP address and the Unix
+// socket that are configured, and returns a function that stops them.
+func startAdmin(config AdminConfig, a *app, logger *slog.Logger) (func(), error) {
+	var servers []*http.Server
+	stop := func() {
+		for _, server := range servers {
+			server.Close()
+		}
+	}
+	serve := func(ln net.Listener, handler http.Handler) {
+		server := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+		servers = append(servers, server)
+		go func() {
+			if err := server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("管理用HTTPサーバーが停止しました", errorAttrs(err)...)
+			}
+		}()
+		logger.Info("管理用HTTPサーバーを起動しました", "listen", ln.Addr().String())
+	}
+
+	if config.Listen != "" {
+		ln, err := net.Listen("tcp", config.Listen)
+		if err != nil {
+			return nil, fmt.Errorf("エラー: 管理用HTTPサーバーを起動できませんでした: %w", err)
+		}
+		// トークンがない場合、TCPでは管理APIを提供しない
+		serve(ln, newAdminHandler(config, a, config.Token != ""))
+	}
+	if config.Socket != "" {
+		ln, err := listenSocket(config.Socket)
+		if err != nil {
+			stop()
+			return nil, fmt.Errorf("エラー: 管理用のUnixソケットを作成できませんでした: %w", err)
+		}
+		serve(ln, newAdminHandler(config, a, true))
+	}
+	return stop, nil
+}
+
+// listenSocket listens on a Unix socket at path that only the owner can
+// connect to. A socket left behind by a process that has exited is replaced,
+// but a socket in use or any other file at path is an error.
+func listenSocket(path string) (net.Listener, error) {
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+
+	// 権限を設定するまで他のユーザーが接続できないよう、所有者だけが入れるディレクトリで作成してから移動する
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".admin-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	tmp := filepath.Join(dir, "admin.sock")
+	ln, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := os.Chmod(tmp, 0600); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("権限を設定できませんでした: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return &socketListener{Listener: ln, path: path}, nil
+}
+
+// removeStaleSocket removes the socket at path when no process listens on it.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s はソケットではないファイルです", path)
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("%s は他のプロセスが使用中です", path)
+	}
+	// 前回の異常終了で残ったソケットファイル
+	return os.Remove(path)
+}
+
+// socketListener removes the socket file when it is closed.
+type socketListener struct {
+	net.Listener
+	path string
+}
+
+func (l *socketListener) Close() error {
+	err := l.Listener.Close()
+	os.Remove(l.path)
+	return err
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminHandler_Metrics(t *testing.T) {
+	reconnects.Inc("admin-test")
+
+	rec := httptest.NewRecorder()
+	newAdminHandler(AdminConfig{}, &app{}, false).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if rec.Code != 200 {
+		t.Fatalf("ステータスコード 200 を期待しましたが、実際: %d", rec.Code)
+	}
+	for _, expected := range []string{
+		"# TYPE misskey_reaction_notes_received_total counter",
+		"# TYPE misskey_reaction_api_request_duration_seconds histogram",
+		`misskey_reaction_reconnects_total{account="admin-test"} 1`,
+	} {
+		if !strings.Contains(rec.Body.String(), expected) {
+			t.Errorf("レスポンスに '%s' が含まれていませんでした: %s", expected, rec.Body.String())
+		}
+	}
+}
+
+func TestStartAdmin_InvalidAddress(t *testing.T) {
+	_, err := startAdmin(AdminConfig{Listen: "invalid address"}, &app{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err == nil || !strings.Contains(err.Error(), "管理用HTTPサーバーを起動できませんでした") {
+		t.Errorf("起動できないエラーを期待しましたが、実際: %v", err)
+	}
+}
+
+func TestListenSocket(t *testing.T) {
+	dir := t.TempDir()
+
+	// 残ったソケットは置き換える
+	stale := filepath.Join(dir, "stale.sock")
+	old, _ := net.Listen("unix", stale)
+	old.(*net.UnixListener).SetUnlinkOnClose(false)
+	old.Close()
+	ln, err := listenSocket(stale)
+	if err != nil {
+		t.Fatalf("残ったソケットの置き換えに失敗しました: %v", err)
+	}
+	if info, err := os.Stat(stale); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("権限 0600 のソケットを期待しましたが、実際: %v, %v", info, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("作成に使ったディレクトリが残らないことを期待しましたが、実際: %v", entries)
+	}
+
+	// 使用中のソケットやソケット以外のファイルは削除しない
+	regular := filepath.Join(dir, "config.yaml")
+	os.WriteFile(regular, []byte("rules: []"), 0644)
+	tests := []struct {
+		name     string
+		path     string
+		expected string
+	}{
+		{"使用中のソケット", stale, "他のプロセスが使用中です"},
+		{"通常のファイル", regular, "ソケットではないファイルです"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := listenSocket(tt.path)
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("エラー '%s' を期待しましたが、実際: %v", tt.expected, err)
+			}
+			if _, err := os.Stat(tt.path); err != nil {
+				t.Errorf("ファイルが残っていることを期待しましたが、実際: %v", err)
+			}
+		})
+	}
+
+	ln.Close()
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("閉じたらソケットを削除することを期待しましたが、実際: %v", err)
+	}
+}
+
+func TestAdminHandler_Health(t *testing.T) {
+	ready := &connState{}
+	ready.setConnected()
+	ready.setSubscribed(time.Now())
+	tests := []struct {
+		name     string
+		path     string
+		accounts []*account
+		code     int
+		expected string
+	}{
+		{"healthz", "/healthz", []*account{{name: "main", conn: &connState{}}}, 200, "ok"},
+		{"準備完了", "/readyz", []*account{{conn: ready}}, 200, "ok"},
+		{"未接続のアカウント", "/readyz", []*account{{name: "main", conn: ready}, {name: "sub", conn: &connState{}}}, 503, "アカウント sub: 接続していません"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			newAdminHandler(AdminConfig{}, &app{accounts: tt.accounts}, false).ServeHTTP(rec, httptest.NewRequest("GET", tt.path, nil))
+
+			if rec.Code != tt.code || strings.TrimSpace(rec.Body.String()) != tt.expected {
+				t.Errorf("期待値: (%d, %q), 実際: (%d, %q)", tt.code, tt.expected, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestAdminHandler_API(t *testing.T) {
+	server := newMockMisskey(t, `{"emojis":[]}`)
+	a, _, _ := newTestApp(t, fmt.Sprintf(testAppConfig, server.URL, "api-greet", "hello"))
+	handler := newAdminHandler(a.config.Admin, a, true)
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		token    string
+		code     int
+		expected string
+	}{
+		{"トークンなし", "GET", "/api/rules", "", 401, "トークンが正しくありません"},
+		{"誤ったトークン", "GET", "/api/rules", "wrong", 401, "トークンが正しくありません"},
+		{"ルールの一覧", "GET", "/api/rules", "secret", 200, `"name":"api-greet","paused":false`},
+		{"キュー", "GET", "/api/queue", "secret", 200, "[]"},
+		{"存在しないルール", "POST", "/api/pause?rule=nope", "secret", 404, "ルール nope は存在しません"},
+		{"存在しないアカウント", "POST", "/api/pause?account=nope", "secret", 404, "アカウント nope は存在しません"},
+		{"ルールの一時停止", "POST", "/api/pause?rule=api-greet", "secret", 204, ""},
+		{"一時停止後の一覧", "GET", "/api/rules", "secret", 200, `"name":"api-greet","paused":true`},
+		{"GETでは一時停止できない", "GET", "/api/pause", "secret", 405, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.code || !strings.Contains(rec.Body.String(), tt.expected) {
+				t.Errorf("期待値: (%d, %q), 実際: (%d, %q)", tt.code, tt.expected, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	// 一時停止したルールではリアクションしない
+	a.accounts[0].currentBot().handleNote(note{ID: "note1", Text: "hello"})
+	if reactions := server.sentReactions(); len(reactions) != 0 {
+		t.Errorf("一時停止中はリアクションしないことを期待しましたが、実際: %+v", reactions)
+	}
+}
+
+func TestAdminHandler_APIDisabled(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newAdminHandler(AdminConfig{}, &app{}, false).ServeHTTP(rec, httptest.NewRequest("GET", "/api/rules", nil))
+	if rec.Code != 404 {
+		t.Errorf("管理APIを無効にした場合は 404 を期待しましたが、実際: %d", rec.Code)
+	}
+}
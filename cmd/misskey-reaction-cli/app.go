@@ -0,0 +1,275 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"misskey-reaction-cli/internal/audit"
+	"misskey-reaction-cli/internal/logrotate"
+)
+
+// defaultConfigWatchInterval は config_watch_interval の省略時の値です。
+const defaultConfigWatchInterval = 5 * time.Second
+
+// app は設定ファイルから作成したアカウントの集まりです。
+type app struct {
+	// configPath は再読み込みに使う設定ファイルのパス (空の場合は再読み込みできない)
+	configPath string
+	// config は起動時の設定。ログや管理用サーバーの設定は再読み込みしても変わらない
+	config   *Config
+	logger   *slog.Logger
+	accounts []*account
+	auditLog *audit.Log
+	// recordFile は受信したフレームの記録ファイル (記録しない場合はnil)
+	recordFile io.Closer
+
+	reloadMu sync.Mutex
+}
+
+// newApp validates the config and creates the accounts.
+func newApp(configPath string, config *Config, logger *slog.Logger) (*app, error) {
+	accountConfigs, err := config.accounts()
+	if err != nil {
+		return nil, fmt.Errorf("エラー: %w", err)
+	}
+
+	a := &app{configPath: configPath, config: config, logger: logger}
+	if config.Audit.Path != "" {
+		if a.auditLog, err = audit.Open(config.Audit.Path, config.Audit.Rotate); err != nil {
+			return nil, fmt.Errorf("エラー: 監査ログを開けませんでした: %w", err)
+		}
+	}
+	var rec *frameRecorder
+	if config.Record.Path != "" {
+		recordFile, err := logrotate.Open(config.Record.Path, config.Record.Rotate)
+		if err != nil {
+			a.close()
+			return nil, fmt.Errorf("エラー: 記録ファイルを開けませんでした: %w", err)
+		}
+		a.recordFile = recordFile
+		rec = newFrameRecorder(recordFile)
+	}
+
+	a.accounts = make([]*account, len(accountConfigs))
+	for i, ac := range accountConfigs {
+		acc, err := newAccount(ac.name, ac.config, accountLogger(logger, ac.name), a.auditLog, rec)
+		if err != nil {
+			a.close()
+			return nil, accountError(ac.name, err)
+		}
+		a.accounts[i] = acc
+	}
+	return a, nil
+}
+
+// close closes the audit log and the recording file.
+func (a *app) close() {
+	a.auditLog.Close()
+	if a.recordFile != nil {
+		a.recordFile.Close()
+	}
+}
+
+// run starts the admin server when configured and runs the accounts until
+// they stop. The audit log and the recording file are closed when it returns.
+func (a *app) run() error {
+	defer a.close()
+
+	if a.config.Admin.Listen != "" || a.config.Admin.Socket != "" {
+		stop, err := startAdmin(a.config.Admin, a, a.logger)
+		if err != nil {
+			return err
+		}
+		defer stop()
+	}
+
+	interval := a.config.ConfigWatchInterval
+	if interval == 0 {
+		interval = defaultConfigWatchInterval
+	}
+	if a.configPath != "" && interval > 0 {
+		stop := make(chan struct{})
+		defer close(stop)
+		go a.watchConfig(interval, stop)
+	}
+
+	if len(a.accounts) == 1 && a.accounts[0].name == "" {
+		return a.accounts[0].run()
+	}
+	return superviseAccounts(a.accounts)
+}
+
+// reload reads the config file again and switches every account to the new
+// rules and limits. Only the accounts whose connection settings changed
+// reconnect. When the new config is invalid, the current config is kept and
+// the reason is returned.
+func (a *app) reload() error {
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+
+	if a.configPath == "" {
+		return errors.New("設定ファイルのパスが分からないため再読み込みできません")
+	}
+	config, err := loadConfig(a.configPath)
+	if err != nil {
+		return fmt.Errorf("設定ファイルの読み込みに失敗しました: %w", err)
+	}
+	accountConfigs, err := config.accounts()
+	if err != nil {
+		return err
+	}
+	if len(accountConfigs) != len(a.accounts) {
+		return errors.New("accountsの追加や削除には再起動が必要です")
+	}
+
+	// すべてのアカウントの設定を検証してから切り替える
+	bots := make([]*bot, 0, len(accountConfigs))
+	receivers := make([]receiveFunc, len(accountConfigs))
+	closeAll := func() {
+		for _, b := range bots {
+			b.close()
+		}
+	}
+	for i, ac := range accountConfigs {
+		current := a.accounts[i]
+		if ac.name != current.name {
+			closeAll()
+			return errors.New("accountsの追加や削除には再起動が必要です")
+		}
+		if err := validateAccountConfig(ac.config); err != nil {
+			closeAll()
+			return accountError(ac.name, err)
+		}
+		if !sameConnection(current.connection(), ac.config) {
+			if receivers[i], err = noteReceiver(ac.config, current.logger, current.conn, current.rec); err != nil {
+				closeAll()
+				return accountError(ac.name, err)
+			}
+		}
+		b, err := newBot(ac.config, current.logger)
+		if err != nil {
+			closeAll()
+			return accountError(ac.name, err)
+		}
+		bots = append(bots, b)
+	}
+
+	for i, b := range bots {
+		a.accounts[i].replaceBot(b)
+		if receivers[i] != nil {
+			a.accounts[i].reconnect(accountConfigs[i].config, receivers[i])
+		}
+	}
+	if changed := restartOnlyChanges(a.config, config); len(changed) > 0 {
+		a.logger.Warn("再起動するまで反映されない設定が変更されています", "settings", changed)
+	}
+	a.logger.Info("設定ファイルを再読み込みしました", "path", a.configPath)
+	return nil
+}
+
+// tryReload reloads the config, logging why the current config is kept when
+// the reload fails.
+func (a *app) tryReload() error {
+	err := a.reload()
+	if err != nil {
+		a.logger.Error("設定ファイルの再読み込みに失敗したため、現在の設定で動作を続けます", errorAttrs(err)...)
+	}
+	return err
+}
+
+// watchConfig reloads the config whenever the content of the config file
+// changes, checking at the interval until stop is closed. A file that cannot
+// be read is skipped, since editors may replace it while saving.
+func (a *app) watchConfig(interval time.Duration, stop <-chan struct{}) {
+	last, _ := fileChecksum(a.configPath)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		sum, err := fileChecksum(a.configPath)
+		if err != nil || sum == last {
+			continue
+		}
+		last = sum
+		a.logger.Info("設定ファイルの変更を検出しました", "path", a.configPath)
+		a.tryReload()
+	}
+}
+
+// fileChecksum returns the SHA-256 checksum of the file content.
+func fileChecksum(path string) ([sha256.Size]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(data), nil
+}
+
+// restartOnlyChanges returns the top-level settings that differ between the
+// configs and are applied only at startup.
+func restartOnlyChanges(old, new *Config) []string {
+	var changed []string
+	if old.LogPath != new.LogPath {
+		changed = append(changed, "log_path")
+	}
+	if old.LogFormat != new.LogFormat {
+		changed = append(changed, "log_format")
+	}
+	if old.LogLevel != new.LogLevel {
+		changed = append(changed, "log_level")
+	}
+	if old.LogRotate != new.LogRotate {
+		changed = append(changed, "log_rotate")
+	}
+	if old.Admin != new.Admin {
+		changed = append(changed, "admin")
+	}
+	if old.Audit != new.Audit {
+		changed = append(changed, "audit")
+	}
+	if old.Record != new.Record {
+		changed = append(changed, "record")
+	}
+	if old.ConfigWatchInterval != new.ConfigWatchInterval {
+		changed = append(changed, "config_watch_interval")
+	}
+	return changed
+}
+
+// sameConnection reports whether the two configs receive notes the same way.
+func sameConnection(a, b *Config) bool {
+	return a.Misskey.URL == b.Misskey.URL &&
+		a.Misskey.Token == b.Misskey.Token &&
+		reflect.DeepEqual(a.Misskey.channels(), b.Misskey.channels()) &&
+		a.Mode == b.Mode &&
+		a.PollInterval == b.PollInterval
+}
+
+// accountError adds the account name to the error when accounts are used.
+func accountError(name string, err error) error {
+	if name == "" {
+		return err
+	}
+	return fmt.Errorf("アカウント %s: %w", name, err)
+}
+
+// findAccount returns the account with the name, or nil.
+func (a *app) findAccount(name string) *account {
+	for _, acc := range a.accounts {
+		if acc.name == name {
+			return acc
+		}
+	}
+	return nil
+}
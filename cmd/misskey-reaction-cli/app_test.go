@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testAppConfig は1つのルールを持つ設定ファイルの内容です。
+const testAppConfig = `
+misskey:
+  url: %q
+  token: "testToken"
+rules:
+  - name: %q
+    match_text: %q
+    emoji: "🎉"
+rate_limit:
+  per_minute: 60
+admin:
+  token: "secret"
+`
+
+// newTestApp は設定ファイルを書き込み、そこから待ち時間なしで動くappを作成します。
+func newTestApp(t *testing.T, content string) (*app, string, *bytes.Buffer) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("設定ファイルの読み込みに失敗しました: %v", err)
+	}
+	var logBuffer bytes.Buffer
+	a, err := newApp(path, config, slog.New(slog.NewTextHandler(&logBuffer, nil)))
+	if err != nil {
+		t.Fatalf("appの作成に失敗しました: %v", err)
+	}
+	for _, acc := range a.accounts {
+		acc.currentBot().delay = func() time.Duration { return 0 }
+	}
+	return a, path, &logBuffer
+}
+
+func TestAppReload(t *testing.T) {
+	server := newMockMisskey(t, `{"emojis":[]}`)
+	a, path, logBuffer := newTestApp(t, fmt.Sprintf(testAppConfig, server.URL, "reload-greet", "hello"))
+	old := a.accounts[0].currentBot()
+	a.accounts[0].pause.set("reload-bye", true)
+
+	os.WriteFile(path, []byte(fmt.Sprintf(`
+misskey:
+  url: %q
+  token: "testToken"
+rules:
+  - name: "reload-bye"
+    match_text: "bye"
+    emoji: "🎉"
+  - name: "reload-thanks"
+    match_text: "thanks"
+    emoji: "🙏"
+rate_limit:
+  per_minute: 60
+`, server.URL)), 0644)
+	if err := a.reload(); err != nil {
+		t.Fatalf("再読み込みに失敗しました: %v", err)
+	}
+
+	b := a.accounts[0].currentBot()
+	if b == old || b.limiter != old.limiter || b.state != old.state {
+		t.Error("新しいbotが頻度制限と状態を引き継ぐことを期待しました")
+	}
+	b.handleNote(note{ID: "note1", Text: "hello"})
+	b.handleNote(note{ID: "note2", Text: "bye"})
+	b.handleNote(note{ID: "note3", Text: "thanks"})
+
+	// 一時停止中のルールは再読み込み後も止まったまま
+	reactions := server.sentReactions()
+	if len(reactions) != 1 || reactions[0].NoteID != "note3" || reactions[0].Reaction != "🙏" {
+		t.Errorf("note3 への 🙏 のリアクションだけを期待しましたが、実際: %+v", reactions)
+	}
+	assertLogLine(t, logBuffer, "設定ファイルを再読み込みしました")
+	assertLogLine(t, logBuffer, "一時停止中のためアクションを実行しません", "rule=reload-bye")
+}
+
+func TestAppReload_Invalid(t *testing.T) {
+	server := newMockMisskey(t, `{"emojis":[]}`)
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{"YAMLの誤り", "rules: [", "設定ファイルのパースに失敗しました"},
+		{"存在しない絵文字", strings.Replace(fmt.Sprintf(testAppConfig, server.URL, "greet", "bye"), "🎉", ":nope:", 1), "カスタム絵文字 :nope: はインスタンスに存在しません"},
+		{"URLの削除", strings.Replace(fmt.Sprintf(testAppConfig, server.URL, "greet", "bye"), "url:", "# url:", 1), "MisskeyのURLが指定されていません"},
+		{"不正なmode", fmt.Sprintf(testAppConfig, server.URL, "greet", "bye") + "mode: \"push\"\n", `mode "push" は不正です`},
+		{"アカウントの追加", fmt.Sprintf(testAppConfig, server.URL, "greet", "bye") + `
+accounts:
+  - name: "sub"
+    url: "https://example.com"
+    token: "subToken"
+`, "accountsの追加や削除には再起動が必要です"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, path, _ := newTestApp(t, fmt.Sprintf(testAppConfig, server.URL, "greet", "hello"))
+			old := a.accounts[0].currentBot()
+
+			os.WriteFile(path, []byte(tt.content), 0644)
+			err := a.reload()
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("エラー '%s' を期待しましたが、実際: %v", tt.expected, err)
+			}
+			if a.accounts[0].currentBot() != old {
+				t.Error("再読み込みに失敗した場合は現在のbotを使い続けることを期待しました")
+			}
+		})
+	}
+}
+
+func TestAppReload_Reconnect(t *testing.T) {
+	before := newMockMisskey(t, `{"emojis":[]}`)
+	before.stream = []note{{ID: "note1", Text: "hello"}}
+	before.hold = make(chan struct{})
+	after := newMockMisskey(t, `{"emojis":[]}`)
+	after.stream = []note{{ID: "note2", Text: "hello"}}
+	after.hold = make(chan struct{})
+
+	a, path, logBuffer := newTestApp(t, fmt.Sprintf(testAppConfig, before.URL, "greet", "hello"))
+	acc := a.accounts[0]
+	done := make(chan error)
+	go func() { done <- acc.run() }()
+	waitForReactions(t, before, 1)
+
+	// 頻度制限を変えないと、引き継いだ制限で2件目のリアクションが待たされる
+	content := strings.Replace(fmt.Sprintf(testAppConfig, after.URL, "greet", "hello"), "per_minute: 60", "per_minute: 6000", 1)
+	os.WriteFile(path, []byte(content), 0644)
+	if err := a.reload(); err != nil {
+		t.Fatalf("再読み込みに失敗しました: %v", err)
+	}
+	waitForReactions(t, after, 1)
+	if acc.connection().Misskey.URL != after.URL {
+		t.Errorf("新しい接続先を期待しましたが、実際: %s", acc.connection().Misskey.URL)
+	}
+
+	// 新しい接続が切れたら (reconnect_interval がないため) 終了する
+	close(after.hold)
+	if err := <-done; err == nil {
+		t.Error("切断のエラーを期待しました")
+	}
+	if reactions := before.sentReactions(); len(reactions) != 1 {
+		t.Errorf("元の接続先へのリアクションは1件を期待しましたが、実際: %+v", reactions)
+	}
+	assertLogLine(t, logBuffer, "接続の設定が変わったため再接続します")
+}
+
+func TestAppReload_ReconnectWithQueuedNotes(t *testing.T) {
+	before := newMockMisskey(t, `{"emojis":[]}`)
+	before.stream = []note{{ID: "note1", Text: "hello"}, {ID: "note2", Text: "hello"}}
+	before.hold = make(chan struct{})
+	after := newMockMisskey(t, `{"emojis":[]}`)
+	after.stream = []note{{ID: "note3", Text: "hello"}}
+	after.hold = make(chan struct{})
+
+	a, path, logBuffer := newTestApp(t, fmt.Sprintf(testAppConfig, before.URL, "greet", "hello"))
+	acc := a.accounts[0]
+	// note1 のリアクションまでの待ち時間の間、note2 がキューに残る
+	release := make(chan struct{})
+	var waited int32
+	acc.currentBot().delay = func() time.Duration {
+		if atomic.CompareAndSwapInt32(&waited, 0, 1) {
+			<-release
+		}
+		return 0
+	}
+	done := make(chan error)
+	go func() { done <- acc.run() }()
+	deadline := time.Now().Add(2 * time.Second)
+	for len(acc.pending()) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("キューに1件残ることを期待しましたが、実際: %+v", acc.pending())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	content := strings.Replace(fmt.Sprintf(testAppConfig, after.URL, "greet", "hello"), "per_minute: 60", "per_minute: 6000", 1)
+	os.WriteFile(path, []byte(content), 0644)
+	if err := a.reload(); err != nil {
+		t.Fatalf("再読み込みに失敗しました: %v", err)
+	}
+	// キューの処理が終わる前に、新しい接続先からノートを受信する
+	deadline = time.Now().Add(2 * time.Second)
+	for len(acc.pending()) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("キューの処理を待たずに再接続することを期待しましたが、実際: %+v", acc.pending())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assertLogLine(t, logBuffer, "接続の設定が変わったため再接続します", "queued=1")
+
+	// 終了する前に、キューに残ったノートを処理し終える
+	close(release)
+	close(after.hold)
+	<-done
+	if len(acc.pending()) != 0 {
+		t.Errorf("キューが空になることを期待しましたが、実際: %+v", acc.pending())
+	}
+	if reactions := after.sentReactions(); len(reactions) == 0 || reactions[0].NoteID != "note2" {
+		t.Errorf("新しい接続先には note2 へのリアクションを期待しましたが、実際: %+v", reactions)
+	}
+	assertLogLine(t, logBuffer, "note_id=note3", "rule=greet")
+	if reactions := before.sentReactions(); len(reactions) != 1 || reactions[0].NoteID != "note1" {
+		t.Errorf("元の接続先には note1 へのリアクションを期待しましたが、実際: %+v", reactions)
+	}
+}
+
+func TestAppWatchConfig(t *testing.T) {
+	server := newMockMisskey(t, `{"emojis":[]}`)
+	a, path, logBuffer := newTestApp(t, fmt.Sprintf(testAppConfig, server.URL, "greet", "hello"))
+	old := a.accounts[0].currentBot()
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		a.watchConfig(10*time.Millisecond, stop)
+		close(done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// 不正な設定は無視して現在の設定を使い続け、次の変更で再読み込みする
+	os.WriteFile(path, []byte("rules: ["), 0644)
+	time.Sleep(50 * time.Millisecond)
+	if a.accounts[0].currentBot() != old {
+		t.Error("不正な設定では現在のbotを使い続けることを期待しました")
+	}
+	os.WriteFile(path, []byte(fmt.Sprintf(testAppConfig, server.URL, "greet", "bye")), 0644)
+	deadline := time.Now().Add(2 * time.Second)
+	for a.accounts[0].currentBot() == old {
+		if time.Now().After(deadline) {
+			t.Fatal("設定ファイルの変更で再読み込みすることを期待しました")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(stop)
+	<-done
+
+	if b := a.accounts[0].currentBot(); b.rules[0].MatchText != "bye" {
+		t.Errorf("新しいルールを期待しましたが、実際: %+v", b.rules)
+	}
+	assertLogLine(t, logBuffer, "level=ERROR", "現在の設定で動作を続けます", "設定ファイルのパースに失敗しました")
+	assertLogLine(t, logBuffer, "設定ファイルの変更を検出しました")
+}
+
+// waitForReactions はサーバーが n 件のリアクションを受け取るまで待ちます。
+func waitForReactions(t *testing.T, server *mockMisskey, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for len(server.sentReactions()) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d 件のリアクションを期待しましたが、実際: %+v", n, server.sentReactions())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNewApp_Audit(t *testing.T) {
+	server := newMockMisskey(t, `{"emojis":[]}`)
+	auditPath := filepath.Join(t.TempDir(), "audit.jsonl")
+	a, _, _ := newTestApp(t, fmt.Sprintf(testAppConfig, server.URL, "greet", "hello")+fmt.Sprintf("audit:\n  path: %q\n", auditPath))
+	a.accounts[0].currentBot().handleNote(note{ID: "note1", Text: "hello"})
+	a.auditLog.Close()
+
+	data, _ := os.ReadFile(auditPath)
+	if !strings.Contains(string(data), `"event":"received","note_id":"note1"`) || !strings.Contains(string(data), `"event":"action","note_id":"note1"`) {
+		t.Errorf("監査ログにnote1の受信とアクションを期待しましたが、実際: %s", data)
+	}
+
+	_, err := newApp("", &Config{Audit: AuditConfig{Path: filepath.Join(auditPath, "invalid")}}, slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	if err == nil || !strings.Contains(err.Error(), "監査ログを開けませんでした") {
+		t.Errorf("監査ログを開けないエラーを期待しましたが、実際: %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"misskey-reaction-cli/internal/audit"
+	"misskey-reaction-cli/internal/logrotate"
+)
+
+// AuditConfig はノートごとの判断を記録する監査ログの設定です。
+type AuditConfig struct {
+	// Path を指定すると、判断をJSON Lines形式で追記する。ログ (log_path) とは別のファイルにする
+	Path string `yaml:"path"`
+	// Rotate はpathのローテートの設定
+	Rotate logrotate.Options `yaml:"rotate"`
+}
+
+// 監査ログに記録するスキップの理由
+const (
+	skipDuplicate = "duplicate"       // 処理済みのノート
+	skipSelf      = "self"            // 自分のノート
+	skipFilter    = "filter"          // どのルールにも一致しない
+	skipSchedule  = "schedule"        // 一致したルールが有効な時間帯ではない
+	skipPaused    = "paused"          // 一時停止中
+	skipAge       = "age"             // max_note_ageより古い
+	skipReacted   = "already_reacted" // 既にリアクションが付いている
+	skipEmoji     = "emoji"           // リアクションの絵文字を決められない
+	skipCooldown  = "cooldown"        // 投稿者がクールダウン中
+	skipDeleted   = "deleted"         // 待っている間にノートが削除された
+	skipQuota     = "quota"           // 頻度制限
+)
+
+// audit writes a record about the note to the audit log.
+func (b *bot) audit(n note, record audit.Record) {
+	if b.auditLog == nil {
+		return
+	}
+	record.Time = b.now()
+	record.Account = b.account
+	record.NoteID = n.ID
+	if !n.CreatedAt.IsZero() {
+		record.NoteAge = b.noteAge(n).String()
+	}
+	if err := b.auditLog.Write(record); err != nil {
+		b.logger.Warn("監査ログの書き込みに失敗しました", errorAttrs(err)...)
+	}
+}
+
+// auditRule records the result of evaluating the rule for the note.
+func (b *bot) auditRule(n note, rule *Rule, result string) {
+	b.audit(n, audit.Record{Event: audit.EventRule, Rule: rule.Name, Result: result})
+}
+
+// auditSkip records why no action is taken for the note. rule is nil when no
+// rule has been chosen yet.
+func (b *bot) auditSkip(n note, rule *Rule, reason, detail string) {
+	record := audit.Record{Event: audit.EventSkip, Reason: reason, Detail: detail}
+	if rule != nil {
+		record.Rule = rule.Name
+	}
+	b.audit(n, record)
+}
+
+// auditAction records the outcome of an action.
+func (b *bot) auditAction(n note, rule *Rule, action Action, reaction, result string, err error) {
+	record := audit.Record{Event: audit.EventAction, Rule: rule.Name, Action: action.Type, Result: result}
+	if action.Type == actionReaction {
+		record.Emoji = reaction
+	}
+	if err != nil {
+		record.Detail = err.Error()
+		if result == audit.ResultError {
+			record.ErrorCode = errorCode(err)
+		}
+	}
+	b.audit(n, record)
+}
+
+// actionResult classifies the error of an action call for the audit log.
+func actionResult(err error) string {
+	switch {
+	case err == nil:
+		return audit.ResultOK
+	case isAPIError(err, "ALREADY_REACTED"), isAPIError(err, "ALREADY_FAVORITED"), isAPIError(err, "ALREADY_CLIPPED"), isAPIError(err, "NO_SUCH_NOTE"):
+		return audit.ResultSkipped
+	default:
+		return audit.ResultError
+	}
+}
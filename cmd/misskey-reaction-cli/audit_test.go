@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"misskey-reaction-cli/internal/audit"
+)
+
+func TestBotHandleNote_Audit(t *testing.T) {
+	server := newMockMisskey(t, `{"emojis":[]}`)
+	config := testConfig(server.URL,
+		Rule{Name: "greet", MatchText: "hello", Emoji: EmojiSet{{Emoji: "🎉"}}, Cooldown: 30 * time.Minute},
+		Rule{Name: "limited", MatchText: "limit", Emoji: EmojiSet{{Emoji: "👍"}}, RateLimit: RateLimitConfig{PerHour: 1}},
+	)
+	config.MaxNoteAge = 5 * time.Minute
+	b, _ := newTestBot(t, config)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+	b.account = "main"
+	var buf bytes.Buffer
+	b.auditLog = audit.New(&buf)
+
+	user := func(id string) noteUser { return noteUser{ID: id} }
+	b.handleNote(note{ID: "note1", Text: "goodbye", User: user("user1")})
+	b.handleNote(note{ID: "note2", Text: "hello", User: user("user1")})
+	b.handleNote(note{ID: "note2", Text: "hello", User: user("user1")})
+	b.handleNote(note{ID: "note3", Text: "hello", User: user("user1")})
+	b.handleNote(note{ID: "note4", Text: "limit"})
+	b.handleNote(note{ID: "note5", Text: "limit"})
+	b.handleNote(note{ID: "note6", Text: "hello", User: user("user2"), CreatedAt: now.Add(-time.Hour)})
+	server.reactionErrorCode = "PERMISSION_DENIED"
+	b.handleNote(note{ID: "note7", Text: "hello", User: user("user3")})
+	b.handleNote(note{ID: "note8", Text: "hello", User: user(mockSelfID)})
+
+	records, err := audit.Read(&buf)
+	if err != nil {
+		t.Fatalf("監査ログを読み込めませんでした: %v", err)
+	}
+	var got []string
+	for _, r := range records {
+		if r.Account != "main" || !r.Time.Equal(now) {
+			t.Errorf("アカウントと時刻が記録されていません: %+v", r)
+		}
+		got = append(got, strings.Join(strings.Fields(strings.Join([]string{r.NoteID, r.Event, r.Rule, r.Action, r.Emoji, r.Result, r.Reason, r.ErrorCode}, " ")), " "))
+	}
+	expected := []string{
+		"note1 received",
+		"note1 rule greet no_match",
+		"note1 rule limited no_match",
+		"note1 skip filter",
+		"note2 received",
+		"note2 rule greet match",
+		"note2 action greet reaction 🎉 ok",
+		"note2 received",
+		"note2 skip duplicate",
+		"note3 received",
+		"note3 rule greet match",
+		"note3 skip greet cooldown",
+		"note4 received",
+		"note4 rule greet no_match",
+		"note4 rule limited match",
+		"note4 action limited reaction 👍 ok",
+		"note5 received",
+		"note5 rule greet no_match",
+		"note5 rule limited match",
+		"note5 skip limited quota",
+		"note6 received",
+		"note6 rule greet match",
+		"note6 skip greet age",
+		"note7 received",
+		"note7 rule greet match",
+		"note7 action greet reaction 🎉 error PERMISSION_DENIED",
+		"note8 received",
+		"note8 skip self",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("期待値:\n%s\n実際:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+	if records[0].Channel != "" || records[0].UserID != "user1" {
+		t.Errorf("受信したノートの投稿者を期待しましたが、実際: %+v", records[0])
+	}
+	// 投稿日時が分かるノートは、すべての行に経過時間を記録する
+	for _, r := range records {
+		expected := ""
+		if r.NoteID == "note6" {
+			expected = "1h0m0s"
+		}
+		if r.NoteAge != expected {
+			t.Errorf("経過時間 %q を期待しましたが、実際: %+v", expected, r)
+		}
+	}
+}
@@ -0,0 +1,509 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"misskey-reaction-cli/internal/audit"
+	"misskey-reaction-cli/internal/emoji"
+)
+
+// bot は受信したノートをルールで判定し、リアクションを投稿します。
+type bot struct {
+	// account はメトリクスのラベルに使うアカウント名 (accountsを使わない場合は空)
+	account  string
+	config   *Config
+	logger   *slog.Logger
+	rules    []Rule
+	schedule *schedule
+	emojis   *emojiCatalog
+	// delay はリアクションまでの待ち時間を返す (テストでは0にする)
+	delay func() time.Duration
+	now   func() time.Time
+
+	// limitMu は再読み込みの前後のbotで頻度制限を共有するためポインタにする
+	limitMu      *sync.Mutex
+	limiter      *rateLimiter
+	ruleLimiters map[string]*rateLimiter
+	cooldowns    *cooldownStore
+	// pause はアカウントの一時停止の状態 (nilの場合は一時停止しない)
+	pause *pauseState
+	// execs はバックグラウンドで実行中のコマンド。再読み込みの前後のbotで共有する
+	execs *sync.WaitGroup
+	// auditLog は判断を記録する監査ログ (nilの場合は記録しない)
+	auditLog *audit.Log
+	// stop を閉じるとカスタム絵文字の一覧の定期更新を止める
+	stop chan struct{}
+
+	// selfID は自分のユーザーID (取得するまでは空)。自分のノートにはアクションしない
+	selfMu sync.Mutex
+	selfID string
+	// lookupSelf は自分のユーザーIDを取得する (ドライランの再生ではAPIを呼ばない)
+	lookupSelf func() (string, error)
+
+	// state は処理済みのノートと、バックフィルの起点になる最後のノートID
+	state       *noteState
+	backfilling int32
+}
+
+// newBot prepares the rules and the custom emoji validation.
+func newBot(config *Config, logger *slog.Logger) (*bot, error) {
+	rules, err := prepareRules(config.rules())
+	if err != nil {
+		return nil, err
+	}
+
+	sched, err := newSchedule(config.Schedule)
+	if err != nil {
+		return nil, fmt.Errorf("エラー: %w", err)
+	}
+
+	b := &bot{
+		config:   config,
+		logger:   logger,
+		rules:    rules,
+		schedule: sched,
+		delay:    randomDelay,
+		now:      time.Now,
+		limitMu:  &sync.Mutex{},
+		execs:    &sync.WaitGroup{},
+		stop:     make(chan struct{}),
+	}
+	b.lookupSelf = func() (string, error) {
+		return fetchSelfID(config.Misskey.URL, config.Misskey.Token)
+	}
+	if err := b.setupRateLimits(); err != nil {
+		return nil, err
+	}
+	if b.cooldowns, err = newCooldownStore(config.CooldownPath); err != nil {
+		return nil, fmt.Errorf("エラー: %w", err)
+	}
+	if b.state, err = loadNoteState(config.StatePath); err != nil {
+		return nil, fmt.Errorf("エラー: %w", err)
+	}
+	if config.Backfill.Enabled {
+		if _, err := timelineEndpoints(config.Misskey.channels()); err != nil {
+			return nil, fmt.Errorf("エラー: backfill: %w", err)
+		}
+	}
+	if err := b.setupEmojiValidation(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// inherit takes over the runtime state of the bot created from the previous
+// config: the processed notes, the cooldowns and the rate limits whose
+// settings did not change.
+func (b *bot) inherit(old *bot) {
+	b.account, b.pause, b.auditLog = old.account, old.pause, old.auditLog
+	b.delay, b.now = old.delay, old.now
+	b.execs = old.execs
+	if b.config.StatePath == old.config.StatePath {
+		b.state = old.state
+	}
+	if b.config.CooldownPath == old.config.CooldownPath {
+		b.cooldowns = old.cooldowns
+	}
+	if b.config.Misskey.URL == old.config.Misskey.URL && b.config.Misskey.Token == old.config.Misskey.Token {
+		old.selfMu.Lock()
+		b.selfID = old.selfID
+		old.selfMu.Unlock()
+	}
+
+	old.limitMu.Lock()
+	defer old.limitMu.Unlock()
+	b.limitMu = old.limitMu
+	if reflect.DeepEqual(b.config.RateLimit, old.config.RateLimit) {
+		b.limiter = old.limiter
+	}
+	for _, rule := range b.rules {
+		for _, prev := range old.rules {
+			if prev.Name == rule.Name && reflect.DeepEqual(prev.RateLimit, rule.RateLimit) {
+				b.ruleLimiters[rule.Name] = old.ruleLimiters[rule.Name]
+			}
+		}
+	}
+}
+
+// close stops the background work of the bot.
+func (b *bot) close() {
+	close(b.stop)
+}
+
+// self returns the user ID of the account, fetching it with the i API the
+// first time.
+func (b *bot) self() (string, error) {
+	b.selfMu.Lock()
+	defer b.selfMu.Unlock()
+	if b.selfID == "" {
+		id, err := b.lookupSelf()
+		if err != nil {
+			return "", fmt.Errorf("自分のアカウントの情報を取得できませんでした: %w", err)
+		}
+		b.selfID = id
+	}
+	return b.selfID, nil
+}
+
+// randomDelay returns a delay of 5 to 8 seconds.
+// 即時リアクションが来るのは怖いので若干遅延させる
+func randomDelay() time.Duration {
+	return time.Duration(rand.Intn(4)+5) * time.Second
+}
+
+// setupRateLimits creates the global and per-rule rate limiters.
+func (b *bot) setupRateLimits() error {
+	var err error
+	if b.limiter, err = newRateLimiter(b.config.RateLimit); err != nil {
+		return fmt.Errorf("エラー: %w", err)
+	}
+	b.ruleLimiters = make(map[string]*rateLimiter, len(b.rules))
+	for _, rule := range b.rules {
+		if b.ruleLimiters[rule.Name], err = newRateLimiter(rule.RateLimit); err != nil {
+			return fmt.Errorf("エラー: ルール %s: %w", rule.Name, err)
+		}
+	}
+	return nil
+}
+
+// reserve consumes the global and per-rule rate limits for one reaction, or
+// returns the reason why the reaction must be suppressed.
+func (b *bot) reserve(rule *Rule) error {
+	b.limitMu.Lock()
+	defer b.limitMu.Unlock()
+
+	now := b.now()
+	if err := b.limiter.check(now); err != nil {
+		return fmt.Errorf("全体の%w", err)
+	}
+	ruleLimiter := b.ruleLimiters[rule.Name]
+	if err := ruleLimiter.check(now); err != nil {
+		return fmt.Errorf("ルールの%w", err)
+	}
+	b.limiter.consume(now)
+	ruleLimiter.consume(now)
+	return nil
+}
+
+// setupEmojiValidation loads the custom emoji list of the instance and checks
+// every custom emoji in the rules against it.
+func (b *bot) setupEmojiValidation() error {
+	v := &b.config.EmojiValidation
+	switch v.OnUnknown {
+	case "":
+		v.OnUnknown = emojiValidationFail
+	case emojiValidationFail, emojiValidationFallback:
+	case emojiValidationOff:
+		return nil
+	default:
+		return fmt.Errorf("エラー: emoji_validation.on_unknown %q は不正です", v.OnUnknown)
+	}
+	if v.FallbackEmoji == "" {
+		v.FallbackEmoji = "👍"
+	}
+	if v.RefreshInterval <= 0 {
+		v.RefreshInterval = time.Hour
+	}
+
+	b.emojis = newEmojiCatalog(func() ([]string, error) {
+		return fetchEmojis(b.config.Misskey.URL, b.config.Misskey.Token)
+	})
+	if err := b.emojis.refresh(); err != nil {
+		b.logger.Warn("カスタム絵文字の一覧を取得できませんでした。取得できるまで絵文字の検証は行いません", errorAttrs(err)...)
+	}
+
+	if v.OnUnknown == emojiValidationFallback {
+		if err := b.emojis.check(v.FallbackEmoji); err != nil {
+			return fmt.Errorf("エラー: emoji_validation.fallback_emoji: %w", err)
+		}
+	}
+	for _, rule := range b.rules {
+		for _, option := range rule.Emoji {
+			if !emoji.IsCustom(option.Emoji) {
+				continue // Unicode絵文字とテンプレートはリアクション時に検証する
+			}
+			if err := b.emojis.check(option.Emoji); err != nil {
+				if v.OnUnknown == emojiValidationFail {
+					return fmt.Errorf("エラー: ルール %s: %w", rule.Name, err)
+				}
+				b.logger.Warn("カスタム絵文字が見つからないため、代わりの絵文字を使います", logKeyRule, rule.Name, logKeyEmoji, option.Emoji, "fallback_emoji", v.FallbackEmoji, logKeyError, err.Error())
+			}
+		}
+	}
+
+	go b.emojis.refreshEvery(v.RefreshInterval, b.logger, b.stop)
+	return nil
+}
+
+// validateReaction checks a custom emoji against the instance emoji list and
+// returns the reaction to send, which is the fallback emoji when configured.
+func (b *bot) validateReaction(reaction string) (string, error) {
+	if b.emojis == nil {
+		return reaction, nil
+	}
+	err := b.emojis.check(reaction)
+	if err == nil {
+		return reaction, nil
+	}
+	if b.config.EmojiValidation.OnUnknown == emojiValidationFallback {
+		b.logger.Warn("カスタム絵文字が見つからないため、代わりの絵文字を使います", logKeyEmoji, reaction, "fallback_emoji", b.config.EmojiValidation.FallbackEmoji, logKeyError, err.Error())
+		return b.config.EmojiValidation.FallbackEmoji, nil
+	}
+	return "", err
+}
+
+// findActiveRule returns the first rule that matches the note and is active
+// now according to the global and per-rule schedules.
+// Misskeyでは1つのノートに1つしかリアクションできないため、最初に一致したルールを採用する
+func (b *bot) findActiveRule(n note) *Rule {
+	now := b.now()
+	var inactive *Rule
+	for i := range b.rules {
+		rule := &b.rules[i]
+		if !rule.match(n.Text) {
+			b.auditRule(n, rule, audit.ResultNoMatch)
+			continue
+		}
+		if (scheduleSet{b.schedule, rule.schedule}).isActive(now) {
+			b.auditRule(n, rule, audit.ResultMatch)
+			return rule
+		}
+		b.auditRule(n, rule, audit.ResultInactive)
+		if inactive == nil {
+			inactive = rule
+		}
+	}
+	if inactive != nil {
+		b.noteLogger(n, inactive).Info("スキップ: ルールに一致しましたが、有効な時間帯ではありません")
+		b.auditSkip(n, inactive, skipSchedule, "")
+	} else {
+		b.auditSkip(n, nil, skipFilter, "")
+	}
+	return nil
+}
+
+// handleNote reacts to the note when it matches one of the rules.
+func (b *bot) handleNote(n note) {
+	// ストリーミングとバックフィルで同じノートを受け取ることがあるため、一度だけ処理する
+	notesReceived.Inc(b.account, n.channel)
+	b.audit(n, audit.Record{Event: audit.EventReceived, Channel: n.channel, UserID: n.authorID()})
+	if !b.state.markSeen(n.ID) {
+		b.auditSkip(n, nil, skipDuplicate, "")
+		return
+	}
+	if err := b.state.save(b.now(), false); err != nil {
+		b.logger.Warn("状態ファイルの保存に失敗しました", errorAttrs(err)...)
+	}
+
+	// 返信や引用で作った自分のノートに再び反応し続けないよう、ルールを判定する前に除外する
+	// 自分のノートか確かめられない場合も除外する
+	selfID, err := b.self()
+	if err != nil {
+		b.logger.Warn("スキップ: 自分のノートか確かめられないため処理しません", append([]any{logKeyNoteID, n.ID, logKeyNoteAge, b.noteAge(n).String()}, errorAttrs(err)...)...)
+		b.auditSkip(n, nil, skipSelf, err.Error())
+		return
+	}
+	if selfID != "" && n.authorID() == selfID {
+		b.logger.Debug("スキップ: 自分のノートです", logKeyNoteID, n.ID, logKeyNoteAge, b.noteAge(n).String())
+		b.auditSkip(n, nil, skipSelf, "")
+		return
+	}
+
+	// 特定文字列に合致するかチェック
+	rule := b.findActiveRule(n)
+	if rule == nil {
+		return // 合致しない場合はスキップ
+	}
+	ruleMatches.Inc(b.account, rule.Name)
+	logger := b.noteLogger(n, rule)
+	if b.pause.isPaused(rule.Name) {
+		logger.Info("抑制: 一時停止中のためアクションを実行しません")
+		b.auditSkip(n, rule, skipPaused, "")
+		return
+	}
+
+	age := b.noteAge(n)
+	if b.config.MaxNoteAge > 0 && age > b.config.MaxNoteAge {
+		logger.Info("スキップ: ノートが古いためリアクションしません", "max_note_age", b.config.MaxNoteAge.String())
+		b.auditSkip(n, rule, skipAge, "max_note_age "+b.config.MaxNoteAge.String())
+		return
+	}
+
+	var reaction string
+	if rule.hasAction(actionReaction) {
+		if n.MyReaction != "" {
+			logger.Info("スキップ: 既にリアクションが付いています", logKeyEmoji, n.MyReaction)
+			b.auditSkip(n, rule, skipReacted, n.MyReaction)
+			return
+		}
+
+		var err error
+		reaction, err = rule.reaction(n.ID, n.Text)
+		if err == nil {
+			reaction, err = b.validateReaction(reaction)
+		}
+		if err != nil {
+			logger.Info("スキップ: リアクションを決められません", errorAttrs(err)...)
+			b.auditSkip(n, rule, skipEmoji, err.Error())
+			return
+		}
+	}
+
+	// 待ち時間の間に同じ投稿者のノートを処理しないよう、先にクールダウンを始める
+	releaseCooldown, ok := b.startCooldown(n, rule)
+	if !ok {
+		return
+	}
+
+	time.Sleep(b.delay())
+
+	// 何もしなかったノートでは投稿者をクールダウンさせない
+	if b.config.RecheckBeforeReaction && !b.recheck(n, rule) {
+		releaseCooldown()
+		return
+	}
+
+	if err := b.reserve(rule); err != nil {
+		logger.Info("抑制: 頻度制限によりアクションを抑制しました", logKeyEmoji, reaction, "reason", err.Error())
+		b.auditSkip(n, rule, skipQuota, err.Error())
+		releaseCooldown()
+		return
+	}
+
+	for _, action := range rule.Actions {
+		if action.Type == actionExec {
+			if out := b.runExec(n, rule, action); out != "" {
+				if validated, err := b.validateReaction(out); err != nil {
+					logger.Warn("コマンドの出力はリアクションに使えません", logKeyEmoji, out, logKeyError, err.Error())
+				} else {
+					reaction = validated
+				}
+			}
+			continue
+		}
+		if !b.performAction(n, rule, action, reaction) {
+			return
+		}
+	}
+}
+
+// noteAge returns how long ago the note was created, rounded to seconds.
+// createdAtが分からない場合は0を返す
+func (b *bot) noteAge(n note) time.Duration {
+	if n.CreatedAt.IsZero() {
+		return 0
+	}
+	return b.now().Sub(n.CreatedAt).Round(time.Second)
+}
+
+// startCooldown starts the rule's cooldown for the author of the note and
+// reports whether the note may be reacted to. The returned function cancels
+// the cooldown when no action is performed after all.
+func (b *bot) startCooldown(n note, rule *Rule) (func(), bool) {
+	userID := n.authorID()
+	if rule.Cooldown <= 0 || userID == "" {
+		return func() {}, true // クールダウンがないか、投稿者が分からない場合は適用しない
+	}
+
+	now := b.now()
+	if remaining, ok := b.cooldowns.acquire(rule.Name, userID, rule.Cooldown, now); !ok {
+		b.noteLogger(n, rule).Info("スキップ: 投稿者がクールダウン中です", "remaining", remaining.Round(time.Second).String())
+		b.auditSkip(n, rule, skipCooldown, "remaining "+remaining.Round(time.Second).String())
+		return nil, false
+	}
+	b.saveCooldowns(now)
+	return func() {
+		b.cooldowns.release(rule.Name, userID, now.Add(rule.Cooldown))
+		b.saveCooldowns(b.now())
+	}, true
+}
+
+func (b *bot) saveCooldowns(now time.Time) {
+	if err := b.cooldowns.save(now); err != nil {
+		b.logger.Warn("クールダウンの保存に失敗しました", errorAttrs(err)...)
+	}
+}
+
+// recheck fetches the note again and reports whether it can still be
+// reacted to. Notes deleted or reacted to during the delay are skipped.
+func (b *bot) recheck(n note, rule *Rule) bool {
+	logger := b.noteLogger(n, rule)
+	latest, err := showNote(b.config.Misskey.URL, n.ID, b.config.Misskey.Token)
+	switch {
+	case err == nil:
+	case isAPIError(err, "NO_SUCH_NOTE"):
+		logger.Info("スキップ: ノートが削除されました")
+		b.auditSkip(n, rule, skipDeleted, "")
+		return false
+	default:
+		// 確認できなくてもリアクション自体は試みる
+		logger.Warn("ノートの再取得に失敗しました", errorAttrs(err)...)
+		return true
+	}
+	if latest.MyReaction != "" && rule.hasAction(actionReaction) {
+		logger.Info("スキップ: 既にリアクションが付いています", logKeyEmoji, latest.MyReaction)
+		b.auditSkip(n, rule, skipReacted, latest.MyReaction)
+		return false
+	}
+	return true
+}
+
+// backfill fetches the notes posted after sinceID from the REST timelines of
+// the subscribed channels and passes them to push, which queues them with the
+// streamed notes. Only one backfill runs at a time.
+func (b *bot) backfill(sinceID string, push func(n note)) {
+	if !atomic.CompareAndSwapInt32(&b.backfilling, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&b.backfilling, 0)
+
+	if sinceID == "" {
+		b.logger.Info("バックフィル: 前回処理したノートが分からないため、スキップします")
+		return
+	}
+	channels := b.config.Misskey.channels()
+	endpoints, err := timelineEndpoints(channels)
+	if err != nil {
+		b.logger.Error("バックフィルに失敗しました", errorAttrs(err)...)
+		return
+	}
+
+	b.logger.Info("バックフィル: 前回処理したノート以降のノートを取得します", "since_id", sinceID)
+	for i, endpoint := range endpoints {
+		b.backfillTimeline(channels[i], endpoint, sinceID, push)
+	}
+}
+
+// backfillTimeline pages through one timeline endpoint from sinceID.
+func (b *bot) backfillTimeline(channel, endpoint, sinceID string, push func(n note)) {
+	maxPages := b.config.Backfill.MaxPages
+	if maxPages <= 0 {
+		maxPages = defaultBackfillMaxPages
+	}
+
+	count := 0
+	for page := 0; page < maxPages; page++ {
+		notes, err := fetchTimeline(b.config.Misskey.URL, endpoint, b.config.Misskey.Token, sinceID, timelinePageSize)
+		if err != nil {
+			b.logger.Error("バックフィル: タイムラインの取得に失敗しました", append([]any{"endpoint", endpoint}, errorAttrs(err)...)...)
+			return
+		}
+		for _, n := range notes {
+			n.channel = channel
+			push(n)
+		}
+		count += len(notes)
+		if len(notes) < timelinePageSize {
+			b.logger.Info("バックフィル: ノートをキューに追加しました", "endpoint", endpoint, "count", count)
+			return
+		}
+		sinceID = notes[len(notes)-1].ID
+	}
+	b.logger.Info("バックフィル: max_pagesに達したため、以降は取得しません", "endpoint", endpoint, "count", count, "max_pages", maxPages)
+}
@@ -0,0 +1,546 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// mockSelfID は mockMisskey の i が返す、botのアカウントのユーザーID
+const mockSelfID = "botUser"
+
+// mockMisskey はテスト用のMisskey APIサーバーです。
+type mockMisskey struct {
+	*httptest.Server
+	emojis string
+
+	mu        sync.Mutex
+	reactions []reactionRequest
+	// notes は notes/show で返すノート (存在しない場合はNO_SUCH_NOTE)
+	notes map[string]note
+	// reactionErrorCode が空でない場合、notes/reactions/create はこのエラーを返す
+	reactionErrorCode string
+	// timeline は notes/timeline で返すノート (古い順)
+	timeline []note
+	// stream はストリーミングで配信するノート。配信後に接続を閉じる
+	stream []note
+	// hold が nil でない場合、配信後も hold が閉じられるかクライアントが切断するまで接続を保つ
+	hold chan struct{}
+	// calls はリアクション以外のアクションのAPI呼び出し
+	calls []apiCall
+	// serverErrors の回数だけ、アクションのAPIは500エラーを返す
+	serverErrors int
+	// echo が nil でない場合、notes/create で作ったノートを自分のノートとしてストリーミングで配信する
+	echo chan note
+	// paths は受け取ったリクエストのパス
+	paths []string
+}
+
+// apiCall は mockMisskey が受け取ったAPI呼び出しです。
+type apiCall struct {
+	Endpoint string
+	Body     map[string]string
+}
+
+func writeAPIError(w http.ResponseWriter, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]string{"message": code, "code": code},
+	})
+}
+
+func newMockMisskey(t *testing.T, emojis string) *mockMisskey {
+	m := &mockMisskey{emojis: emojis}
+	m.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		m.paths = append(m.paths, r.URL.Path)
+		m.mu.Unlock()
+		switch r.URL.Path {
+		case "/api/i":
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(noteUser{ID: mockSelfID, Username: "bot"})
+		case "/api/emojis":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(m.emojis))
+		case "/api/notes/reactions/create":
+			var req reactionRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("リクエストボディのパースに失敗しました: %v", err)
+			}
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			if m.serverErrors > 0 {
+				m.serverErrors--
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			if m.reactionErrorCode != "" {
+				writeAPIError(w, m.reactionErrorCode)
+				return
+			}
+			m.reactions = append(m.reactions, req)
+			w.WriteHeader(http.StatusNoContent)
+		case "/api/notes/show":
+			var req struct {
+				NoteID string `json:"noteId"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			m.mu.Lock()
+			n, ok := m.notes[req.NoteID]
+			m.mu.Unlock()
+			if !ok {
+				writeAPIError(w, "NO_SUCH_NOTE")
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(n)
+		case "/api/notes/timeline":
+			var req struct {
+				SinceID string `json:"sinceId"`
+				Limit   int    `json:"limit"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			m.mu.Lock()
+			notes := []note{}
+			for _, n := range m.timeline {
+				if noteIDLess(req.SinceID, n.ID) && len(notes) < req.Limit {
+					notes = append(notes, n)
+				}
+			}
+			m.mu.Unlock()
+			// Misskeyと同じく新しい順で返す
+			for i, j := 0, len(notes)-1; i < j; i, j = i+1, j-1 {
+				notes[i], notes[j] = notes[j], notes[i]
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(notes)
+		case "/api/notes/create", "/api/notes/favorites/create", "/api/clips/add-note":
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			m.mu.Lock()
+			m.calls = append(m.calls, apiCall{Endpoint: strings.TrimPrefix(r.URL.Path, "/api/"), Body: body})
+			id := fmt.Sprintf("created%d", len(m.calls))
+			m.mu.Unlock()
+			if m.echo != nil && r.URL.Path == "/api/notes/create" {
+				m.echo <- note{ID: id, Text: body["text"], User: noteUser{ID: mockSelfID, Username: "bot"}}
+			}
+			w.WriteHeader(http.StatusNoContent)
+		case "/streaming":
+			conn, err := websocket.Upgrade(w, r, nil, 1024, 1024)
+			if err != nil {
+				t.Errorf("WebSocketアップグレードに失敗しました: %v", err)
+				return
+			}
+			defer conn.Close()
+			for _, n := range m.stream {
+				event := streamNoteEvent{Type: "channel"}
+				event.Body.Type = "note"
+				event.Body.Body = n
+				conn.WriteJSON(event)
+			}
+			if m.echo != nil {
+				select {
+				case n := <-m.echo:
+					event := streamNoteEvent{Type: "channel"}
+					event.Body.Type = "note"
+					event.Body.Body = n
+					conn.WriteJSON(event)
+				case <-time.After(5 * time.Second):
+					t.Errorf("自分のノートを配信できませんでした")
+				}
+			}
+			if m.hold != nil {
+				closed := make(chan struct{})
+				go func() {
+					defer close(closed)
+					for {
+						if _, _, err := conn.ReadMessage(); err != nil {
+							return
+						}
+					}
+				}()
+				select {
+				case <-m.hold:
+				case <-closed:
+				}
+			}
+		default:
+			t.Errorf("想定外のパス: %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(m.Close)
+	return m
+}
+
+func (m *mockMisskey) sentReactions() []reactionRequest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]reactionRequest(nil), m.reactions...)
+}
+
+func (m *mockMisskey) requestPaths() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.paths...)
+}
+
+func (m *mockMisskey) apiCalls() []apiCall {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]apiCall(nil), m.calls...)
+}
+
+// newTestBot は待ち時間なしで動くbotを作成します。
+func newTestBot(t *testing.T, config *Config) (*bot, *bytes.Buffer) {
+	t.Helper()
+	var logBuffer bytes.Buffer
+	b, err := newBot(config, slog.New(slog.NewTextHandler(&logBuffer, nil)))
+	if err != nil {
+		t.Fatalf("botの作成に失敗しました: %v", err)
+	}
+	b.delay = func() time.Duration { return 0 }
+	return b, &logBuffer
+}
+
+// assertLogLine はログにpartsをすべて含む行があることを確認します。
+func assertLogLine(t *testing.T, logBuffer *bytes.Buffer, parts ...string) {
+	t.Helper()
+	for _, line := range strings.Split(logBuffer.String(), "\n") {
+		found := true
+		for _, part := range parts {
+			if !strings.Contains(line, part) {
+				found = false
+				break
+			}
+		}
+		if found {
+			return
+		}
+	}
+	t.Errorf("ログに %q をすべて含む行がありませんでした: %s", parts, logBuffer.String())
+}
+
+func testConfig(url string, rules ...Rule) *Config {
+	config := &Config{Rules: rules}
+	config.Misskey.URL = url
+	config.Misskey.Token = "testToken"
+	return config
+}
+
+func TestBotHandleNote(t *testing.T) {
+	server := newMockMisskey(t, `{"emojis":[]}`)
+	b, _ := newTestBot(t, testConfig(server.URL, Rule{MatchText: "hello", Emoji: EmojiSet{{Emoji: "🎉"}}}))
+
+	b.handleNote(note{ID: "note1", Text: "hello world"})
+	b.handleNote(note{ID: "note2", Text: "goodbye"})
+
+	reactions := server.sentReactions()
+	if len(reactions) != 1 || reactions[0].NoteID != "note1" || reactions[0].Reaction != "🎉" {
+		t.Errorf("note1 への 🎉 のリアクションだけを期待しましたが、実際: %+v", reactions)
+	}
+}
+
+func TestNewBot_UnknownCustomEmoji(t *testing.T) {
+	server := newMockMisskey(t, `{"emojis":[{"name":"awesome"}]}`)
+
+	config := testConfig(server.URL, Rule{Name: "typo", MatchText: "hello", Emoji: EmojiSet{{Emoji: ":awsome:"}}})
+	_, err := newBot(config, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err == nil || !strings.Contains(err.Error(), "カスタム絵文字 :awsome: はインスタンスに存在しません") {
+		t.Fatalf("存在しない絵文字のエラーを期待しましたが、実際: %v", err)
+	}
+
+	// リモートの絵文字はインスタンスに存在してもリアクションに使えない
+	config = testConfig(server.URL, Rule{Name: "remote", MatchText: "hello", Emoji: EmojiSet{{Emoji: ":awesome@misskey.io:"}}})
+	_, err = newBot(config, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err == nil || !strings.Contains(err.Error(), "ルール remote: リモートのカスタム絵文字 :awesome@misskey.io: はリアクションに使えません") {
+		t.Errorf("リモートの絵文字のエラーを期待しましたが、実際: %v", err)
+	}
+
+	config = testConfig(server.URL, Rule{Name: "ok", MatchText: "hello", Emoji: EmojiSet{{Emoji: ":awesome:"}}})
+	if _, err := newBot(config, slog.New(slog.NewTextHandler(io.Discard, nil))); err != nil {
+		t.Errorf("存在する絵文字ではエラーにならないことを期待しましたが、実際: %v", err)
+	}
+}
+
+func TestBotHandleNote_FallbackEmoji(t *testing.T) {
+	server := newMockMisskey(t, `{"emojis":[{"name":"awesome"}]}`)
+	config := testConfig(server.URL, Rule{MatchType: "regex", MatchText: `気分: (:[\w@.]+:)`, Emoji: EmojiSet{{Emoji: "$1"}}})
+	config.EmojiValidation.OnUnknown = emojiValidationFallback
+	config.EmojiValidation.FallbackEmoji = "🙂"
+	b, logBuffer := newTestBot(t, config)
+
+	b.handleNote(note{ID: "note1", Text: "気分: :awesome:"})
+	b.handleNote(note{ID: "note2", Text: "気分: :unknown:"})
+	b.handleNote(note{ID: "note3", Text: "気分: :awesome@misskey.io:"})
+
+	reactions := server.sentReactions()
+	if len(reactions) != 3 || reactions[0].Reaction != ":awesome:" || reactions[1].Reaction != "🙂" || reactions[2].Reaction != "🙂" {
+		t.Errorf(":awesome: と 🙂 と 🙂 のリアクションを期待しましたが、実際: %+v", reactions)
+	}
+	assertLogLine(t, logBuffer, "level=WARN", "代わりの絵文字を使います", "fallback_emoji=🙂")
+}
+
+func TestBotHandleNote_UnknownTemplateEmojiSkipped(t *testing.T) {
+	server := newMockMisskey(t, `{"emojis":[{"name":"awesome"}]}`)
+	b, logBuffer := newTestBot(t, testConfig(server.URL, Rule{MatchType: "regex", MatchText: `気分: (:\w+:)`, Emoji: EmojiSet{{Emoji: "$1"}}}))
+
+	b.handleNote(note{ID: "note1", Text: "気分: :unknown:"})
+
+	if reactions := server.sentReactions(); len(reactions) != 0 {
+		t.Errorf("リアクションしないことを期待しましたが、実際: %+v", reactions)
+	}
+	if !strings.Contains(logBuffer.String(), "スキップ") {
+		t.Errorf("ログにスキップが含まれていませんでした: %s", logBuffer.String())
+	}
+}
+
+func TestBotHandleNote_MyReaction(t *testing.T) {
+	server := newMockMisskey(t, `{"emojis":[]}`)
+	b, logBuffer := newTestBot(t, testConfig(server.URL, Rule{MatchText: "hello"}))
+
+	b.handleNote(note{ID: "note1", Text: "hello", MyReaction: "❤"})
+
+	if reactions := server.sentReactions(); len(reactions) != 0 {
+		t.Errorf("リアクションしないことを期待しましたが、実際: %+v", reactions)
+	}
+	assertLogLine(t, logBuffer, "スキップ: 既にリアクションが付いています", "note_id=note1", "emoji=❤")
+}
+
+func TestBotHandleNote_Recheck(t *testing.T) {
+	server := newMockMisskey(t, `{"emojis":[]}`)
+	server.notes = map[string]note{
+		"alive":   {ID: "alive", Text: "hello"},
+		"reacted": {ID: "reacted", Text: "hello", MyReaction: "👍"},
+	}
+	config := testConfig(server.URL, Rule{MatchText: "hello"})
+	config.RecheckBeforeReaction = true
+	b, logBuffer := newTestBot(t, config)
+
+	b.handleNote(note{ID: "alive", Text: "hello"})
+	b.handleNote(note{ID: "reacted", Text: "hello"})
+	b.handleNote(note{ID: "deleted", Text: "hello"})
+
+	reactions := server.sentReactions()
+	if len(reactions) != 1 || reactions[0].NoteID != "alive" {
+		t.Errorf("alive へのリアクションだけを期待しましたが、実際: %+v", reactions)
+	}
+	assertLogLine(t, logBuffer, "スキップ: 既にリアクションが付いています", "note_id=reacted", "emoji=👍")
+	assertLogLine(t, logBuffer, "スキップ: ノートが削除されました", "note_id=deleted")
+}
+
+func TestBotHandleNote_AlreadyReacted(t *testing.T) {
+	server := newMockMisskey(t, `{"emojis":[]}`)
+	server.reactionErrorCode = "ALREADY_REACTED"
+	b, logBuffer := newTestBot(t, testConfig(server.URL, Rule{MatchText: "hello"}))
+
+	b.handleNote(note{ID: "note1", Text: "hello"})
+
+	if strings.Contains(logBuffer.String(), "level=ERROR") {
+		t.Errorf("エラーとしてログに出力されないことを期待しました: %s", logBuffer.String())
+	}
+	assertLogLine(t, logBuffer, "level=INFO", "スキップ: 既にリアクション済みでした", "note_id=note1", "error_code=ALREADY_REACTED")
+}
+
+func TestBotHandleNote_RateLimit(t *testing.T) {
+	server := newMockMisskey(t, `{"emojis":[]}`)
+	config := testConfig(server.URL,
+		Rule{Name: "limited", MatchText: "hello", RateLimit: RateLimitConfig{PerHour: 1}},
+		Rule{Name: "other", MatchText: "bye"},
+	)
+	config.RateLimit.PerDay = 2
+	b, logBuffer := newTestBot(t, config)
+
+	b.handleNote(note{ID: "note1", Text: "hello"})
+	b.handleNote(note{ID: "note2", Text: "hello"}) // ルールの上限
+	b.handleNote(note{ID: "note3", Text: "bye"})
+	b.handleNote(note{ID: "note4", Text: "bye"}) // 全体の上限
+
+	reactions := server.sentReactions()
+	if len(reactions) != 2 || reactions[0].NoteID != "note1" || reactions[1].NoteID != "note3" {
+		t.Errorf("note1 と note3 へのリアクションを期待しましたが、実際: %+v", reactions)
+	}
+	assertLogLine(t, logBuffer, "抑制: 頻度制限によりアクションを抑制しました", "note_id=note2", "rule=limited", "emoji=👍", "ルールの1時間の上限 1 件に達しました")
+	assertLogLine(t, logBuffer, "抑制: 頻度制限によりアクションを抑制しました", "note_id=note4", "rule=other", "emoji=👍", "全体の1日の上限 2 件に達しました")
+}
+
+func TestBotHandleNote_Cooldown(t *testing.T) {
+	server := newMockMisskey(t, `{"emojis":[]}`)
+	b, logBuffer := newTestBot(t, testConfig(server.URL, Rule{MatchText: "hello", Cooldown: 30 * time.Minute}))
+	alice := noteUser{ID: "u1", Username: "alice"}
+
+	b.handleNote(note{ID: "note1", Text: "hello", User: alice})
+	b.handleNote(note{ID: "note2", Text: "hello", User: alice})
+	b.handleNote(note{ID: "note3", Text: "hello", User: noteUser{ID: "u2", Username: "bob", Host: "example.com"}})
+
+	reactions := server.sentReactions()
+	if len(reactions) != 2 || reactions[0].NoteID != "note1" || reactions[1].NoteID != "note3" {
+		t.Errorf("note1 と note3 へのリアクションを期待しましたが、実際: %+v", reactions)
+	}
+	assertLogLine(t, logBuffer, "スキップ: 投稿者がクールダウン中です", "note_id=note2", "user=@alice")
+}
+
+func TestBotHandleNote_CooldownReleased(t *testing.T) {
+	server := newMockMisskey(t, `{"emojis":[]}`)
+	b, logBuffer := newTestBot(t, testConfig(server.URL, Rule{MatchText: "hello", Cooldown: 2 * time.Hour, RateLimit: RateLimitConfig{PerHour: 1}}))
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+	bob := noteUser{ID: "u2", Username: "bob"}
+
+	b.handleNote(note{ID: "note1", Text: "hello", User: noteUser{ID: "u1", Username: "alice"}})
+	b.handleNote(note{ID: "note2", Text: "hello", User: bob}) // ルールの上限
+	// 上限で何もしなかったため、bobはクールダウン中ではない
+	now = now.Add(time.Hour)
+	b.handleNote(note{ID: "note3", Text: "hello", User: bob})
+
+	reactions := server.sentReactions()
+	if len(reactions) != 2 || reactions[0].NoteID != "note1" || reactions[1].NoteID != "note3" {
+		t.Errorf("note1 と note3 へのリアクションを期待しましたが、実際: %+v", reactions)
+	}
+	assertLogLine(t, logBuffer, "抑制: 頻度制限によりアクションを抑制しました", "note_id=note2")
+}
+
+func TestBotHandleNote_Schedule(t *testing.T) {
+	server := newMockMisskey(t, `{"emojis":[]}`)
+	config := testConfig(server.URL,
+		Rule{Name: "work", MatchText: "hello", Emoji: EmojiSet{{Emoji: "💼"}}, Schedule: ScheduleConfig{
+			Timezone: "UTC",
+			Active:   []TimeWindow{{Hours: "09:00-18:00"}},
+		}},
+		Rule{Name: "fallback", MatchText: "hello", Emoji: EmojiSet{{Emoji: "👋"}}},
+	)
+	config.Schedule = ScheduleConfig{Timezone: "UTC", Quiet: []TimeWindow{{Weekdays: []string{"sat", "sun"}}}}
+	b, logBuffer := newTestBot(t, config)
+
+	// 2024-01-01 (月)
+	b.now = func() time.Time { return time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC) }
+	b.handleNote(note{ID: "note1", Text: "hello"})
+	b.now = func() time.Time { return time.Date(2024, 1, 1, 20, 0, 0, 0, time.UTC) }
+	b.handleNote(note{ID: "note2", Text: "hello"})
+	b.now = func() time.Time { return time.Date(2024, 1, 6, 10, 0, 0, 0, time.UTC) }
+	b.handleNote(note{ID: "note3", Text: "hello"})
+
+	reactions := server.sentReactions()
+	if len(reactions) != 2 || reactions[0].Reaction != "💼" || reactions[1].Reaction != "👋" {
+		t.Errorf("💼 と 👋 のリアクションを期待しましたが、実際: %+v", reactions)
+	}
+	assertLogLine(t, logBuffer, "有効な時間帯ではありません", "note_id=note3", "rule=work")
+}
+
+func TestBotHandleNote_MaxNoteAge(t *testing.T) {
+	server := newMockMisskey(t, `{"emojis":[]}`)
+	config := testConfig(server.URL, Rule{MatchText: "hello", Cooldown: 30 * time.Minute})
+	config.MaxNoteAge = 5 * time.Minute
+	b, logBuffer := newTestBot(t, config)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+
+	var fresh, again, stale note
+	json.Unmarshal([]byte(`{"id":"fresh","text":"hello","createdAt":"2024-01-01T11:59:30.000Z","user":{"id":"u1"}}`), &fresh)
+	json.Unmarshal([]byte(`{"id":"again","text":"hello","createdAt":"2024-01-01T11:59:50.000Z","user":{"id":"u1"}}`), &again)
+	json.Unmarshal([]byte(`{"id":"stale","text":"hello","createdAt":"2024-01-01T11:50:00.000Z"}`), &stale)
+
+	b.handleNote(fresh)
+	b.handleNote(again)
+	b.handleNote(stale)
+	b.handleNote(note{ID: "unknown", Text: "hello"}) // createdAtがない場合は制限しない
+
+	reactions := server.sentReactions()
+	if len(reactions) != 2 || reactions[0].NoteID != "fresh" || reactions[1].NoteID != "unknown" {
+		t.Errorf("fresh と unknown へのリアクションを期待しましたが、実際: %+v", reactions)
+	}
+	assertLogLine(t, logBuffer, "スキップ: ノートが古いためリアクションしません", "note_id=stale", "note_age=10m0s", "max_note_age=5m0s")
+	assertLogLine(t, logBuffer, "アクションを実行しました", "note_id=fresh", "rule=rule1", "emoji=👍", "note_age=30s")
+	// リアクション以外の判断の行にも経過時間を出力する
+	assertLogLine(t, logBuffer, "スキップ: 投稿者がクールダウン中です", "note_id=again", "note_age=10s")
+}
+
+func TestBotBackfill(t *testing.T) {
+	server := newMockMisskey(t, `{"emojis":[]}`)
+	for i := 0; i < 150; i++ {
+		server.timeline = append(server.timeline, note{ID: fmt.Sprintf("n%03d", i), Text: "hello"})
+	}
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	os.WriteFile(statePath, []byte(`{"last_note_id":"n139"}`), 0644)
+
+	config := testConfig(server.URL, Rule{MatchText: "hello"})
+	config.Backfill.Enabled = true
+	config.StatePath = statePath
+	b, logBuffer := newTestBot(t, config)
+
+	// ストリーミングで先に受信したノートは二重に処理しない
+	since := b.state.last()
+	b.handleNote(note{ID: "n145", Text: "hello"})
+	queue := newNoteQueue(noteQueueCapacity, nil)
+	b.backfill(since, queue.push)
+
+	// 取得したノートはキューに入れるだけで、その場では処理しない
+	if depth := queue.len(); depth != 10 {
+		t.Errorf("10件のノートがキューに入ることを期待しましたが、実際: %d", depth)
+	}
+	if reactions := server.sentReactions(); len(reactions) != 1 {
+		t.Errorf("キューの処理前は n145 だけへのリアクションを期待しましたが、実際: %+v", reactions)
+	}
+	for _, n := range queue.pending() {
+		if n.channel != "homeTimeline" {
+			t.Errorf("受信したチャンネルを期待しましたが、実際: %q", n.channel)
+		}
+		b.handleNote(n)
+	}
+
+	var got []string
+	for _, r := range server.sentReactions() {
+		got = append(got, r.NoteID)
+	}
+	expected := []string{"n145", "n140", "n141", "n142", "n143", "n144", "n146", "n147", "n148", "n149"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("期待値: %v, 実際: %v", expected, got)
+	}
+	assertLogLine(t, logBuffer, "バックフィル: ノートをキューに追加しました", "endpoint=notes/timeline", "count=10")
+	if last := b.state.last(); last != "n149" {
+		t.Errorf("最後のノートID n149 を期待しましたが、実際: %s", last)
+	}
+}
+
+func TestBotBackfill_NoState(t *testing.T) {
+	server := newMockMisskey(t, `{"emojis":[]}`)
+	server.timeline = []note{{ID: "n001", Text: "hello"}}
+	config := testConfig(server.URL, Rule{MatchText: "hello"})
+	config.Backfill.Enabled = true
+	b, logBuffer := newTestBot(t, config)
+
+	b.backfill(b.state.last(), b.handleNote)
+
+	if reactions := server.sentReactions(); len(reactions) != 0 {
+		t.Errorf("リアクションしないことを期待しましたが、実際: %+v", reactions)
+	}
+	if !strings.Contains(logBuffer.String(), "前回処理したノートが分からないため、スキップします") {
+		t.Errorf("ログにスキップが含まれていませんでした: %s", logBuffer.String())
+	}
+}
+
+func TestNewBot_BackfillUnknownChannel(t *testing.T) {
+	server := newMockMisskey(t, `{"emojis":[]}`)
+	config := testConfig(server.URL, Rule{MatchText: "hello"})
+	config.Misskey.Channel = "main"
+	config.Backfill.Enabled = true
+
+	_, err := newBot(config, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err == nil || !strings.Contains(err.Error(), "チャンネル main に対応するタイムラインのエンドポイントがありません") {
+		t.Errorf("チャンネルのエラーを期待しましたが、実際: %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"misskey-reaction-cli/internal/audit"
+)
+
+// decisionKey はノートを区別するキーです。アカウントごとに別のノートとして扱う
+type decisionKey struct {
+	account string
+	noteID  string
+}
+
+// auditDecisions summarizes the final decision about each note in the audit
+// records, such as "skip (cooldown)" or "greet: reaction 🎉". Notes are
+// returned in the order they were received. The second handling of a note
+// ("duplicate") is ignored, and a dry run counts the same as a successful
+// call so that a replay can be compared with the log of the running bot.
+func auditDecisions(records []audit.Record) ([]decisionKey, map[decisionKey]string) {
+	var order []decisionKey
+	decisions := make(map[decisionKey]string)
+	for _, r := range records {
+		key := decisionKey{account: r.Account, noteID: r.NoteID}
+		if _, ok := decisions[key]; !ok {
+			order = append(order, key)
+			decisions[key] = ""
+		}
+		switch r.Event {
+		case audit.EventSkip:
+			if r.Reason == skipDuplicate {
+				continue
+			}
+			decisions[key] = fmt.Sprintf("skip (%s)", r.Reason)
+		case audit.EventAction:
+			action := r.Action
+			if r.Emoji != "" {
+				action += " " + r.Emoji
+			}
+			if r.Result != audit.ResultOK && r.Result != audit.ResultDryRun {
+				action += " (" + r.Result + ")"
+			}
+			if prev := decisions[key]; strings.HasPrefix(prev, r.Rule+": ") {
+				decisions[key] = prev + ", " + action
+			} else {
+				decisions[key] = r.Rule + ": " + action
+			}
+		}
+	}
+	return order, decisions
+}
+
+// readAuditFile reads every record of the audit log at path.
+func readAuditFile(path string) ([]audit.Record, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("監査ログを開けませんでした: %w", err)
+	}
+	defer file.Close()
+	return audit.Read(file)
+}
+
+// compareAudit prints the notes of the replayed audit log whose decision
+// differs from the baseline audit log. Notes missing from the baseline, such
+// as notes received outside of the period it covers, are only counted.
+func compareAudit(baselinePath, replayedPath string, w io.Writer) error {
+	baselineRecords, err := readAuditFile(baselinePath)
+	if err != nil {
+		return err
+	}
+	replayedRecords, err := readAuditFile(replayedPath)
+	if err != nil {
+		return err
+	}
+	_, baseline := auditDecisions(baselineRecords)
+	order, replayed := auditDecisions(replayedRecords)
+
+	var compared, missing int
+	var changed []string
+	for _, key := range order {
+		before, ok := baseline[key]
+		if !ok {
+			missing++
+			continue
+		}
+		compared++
+		if after := replayed[key]; after != before {
+			name := key.noteID
+			if key.account != "" {
+				name = key.account + "/" + name
+			}
+			changed = append(changed, fmt.Sprintf("  %s: %s -> %s\n", name, before, after))
+		}
+	}
+
+	fmt.Fprintf(w, "監査ログとの比較: 比較したノート %d 件, 判断が変わったノート %d 件, 監査ログにないノート %d 件\n", compared, len(changed), missing)
+	for _, line := range changed {
+		fmt.Fprint(w, line)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"misskey-reaction-cli/internal/audit"
+	"misskey-reaction-cli/internal/logrotate"
+)
+
+// writeAudit は監査ログのファイルを書き込みます。
+func writeAudit(t *testing.T, path string, records ...audit.Record) {
+	t.Helper()
+	log, err := audit.Open(path, logrotate.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	for _, r := range records {
+		log.Write(r)
+	}
+}
+
+func TestAuditDecisions(t *testing.T) {
+	records := []audit.Record{
+		{Event: audit.EventReceived, NoteID: "note1"},
+		{Event: audit.EventSkip, NoteID: "note1", Reason: skipFilter},
+		{Event: audit.EventReceived, NoteID: "note2"},
+		{Event: audit.EventAction, NoteID: "note2", Rule: "greet", Action: actionReaction, Emoji: "🎉", Result: audit.ResultDryRun},
+		{Event: audit.EventAction, NoteID: "note2", Rule: "greet", Action: actionRenote, Result: audit.ResultError},
+		// 重複して受信した場合は最初の判断を使う
+		{Event: audit.EventReceived, NoteID: "note2"},
+		{Event: audit.EventSkip, NoteID: "note2", Reason: skipDuplicate},
+		{Event: audit.EventReceived, Account: "sub", NoteID: "note1"},
+		{Event: audit.EventAction, Account: "sub", NoteID: "note1", Rule: "greet", Action: actionReaction, Emoji: "👍", Result: audit.ResultOK},
+	}
+
+	order, decisions := auditDecisions(records)
+
+	expected := []struct {
+		key      decisionKey
+		decision string
+	}{
+		{decisionKey{noteID: "note1"}, "skip (filter)"},
+		{decisionKey{noteID: "note2"}, "greet: reaction 🎉, renote (error)"},
+		{decisionKey{account: "sub", noteID: "note1"}, "greet: reaction 👍"},
+	}
+	if len(order) != len(expected) {
+		t.Fatalf("%d 件のノートを期待しましたが、実際: %v", len(expected), order)
+	}
+	for i, e := range expected {
+		if order[i] != e.key || decisions[e.key] != e.decision {
+			t.Errorf("%d 番目 期待値: %v %q, 実際: %v %q", i, e.key, e.decision, order[i], decisions[order[i]])
+		}
+	}
+}
+
+func TestCompareAudit(t *testing.T) {
+	dir := t.TempDir()
+	baseline, replayed := filepath.Join(dir, "baseline.jsonl"), filepath.Join(dir, "replayed.jsonl")
+	writeAudit(t, baseline,
+		audit.Record{Event: audit.EventAction, NoteID: "note1", Rule: "greet", Action: actionReaction, Emoji: "🎉", Result: audit.ResultOK},
+		audit.Record{Event: audit.EventSkip, NoteID: "note2", Rule: "greet", Reason: skipCooldown},
+		audit.Record{Event: audit.EventSkip, NoteID: "note0", Reason: skipFilter},
+	)
+	writeAudit(t, replayed,
+		audit.Record{Event: audit.EventAction, NoteID: "note1", Rule: "greet", Action: actionReaction, Emoji: "🎉", Result: audit.ResultDryRun},
+		audit.Record{Event: audit.EventAction, NoteID: "note2", Rule: "greet", Action: actionReaction, Emoji: "🎉", Result: audit.ResultDryRun},
+		audit.Record{Event: audit.EventSkip, NoteID: "note3", Reason: skipFilter},
+	)
+
+	var out bytes.Buffer
+	if err := compareAudit(baseline, replayed, &out); err != nil {
+		t.Fatalf("比較に失敗しました: %v", err)
+	}
+	expected := "監査ログとの比較: 比較したノート 2 件, 判断が変わったノート 1 件, 監査ログにないノート 1 件\n" +
+		"  note2: skip (cooldown) -> greet: reaction 🎉\n"
+	if out.String() != expected {
+		t.Errorf("期待値: %q, 実際: %q", expected, out.String())
+	}
+
+	if err := compareAudit(filepath.Join(dir, "missing.jsonl"), replayed, &out); err == nil || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("存在しない監査ログのエラーを期待しましたが、実際: %v", err)
+	}
+}
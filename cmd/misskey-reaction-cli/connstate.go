@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// defaultIdleTimeout は admin.idle_timeout が省略されたときの、準備完了とみなす最後のメッセージからの時間です。
+const defaultIdleTimeout = 10 * time.Minute
+
+// connState はノートの受信の接続状態です。nilの場合は何も記録しない
+type connState struct {
+	// account は lastMessage のメトリクスのラベル
+	account string
+
+	mu          sync.Mutex
+	connected   bool
+	subscribed  bool
+	lastMessage time.Time
+}
+
+// setConnected records that the connection was established.
+func (s *connState) setConnected() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.connected = true
+}
+
+// setSubscribed records that every channel was subscribed. The idle window
+// starts from this time until the first message arrives.
+func (s *connState) setSubscribed(now time.Time) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscribed = true
+	s.lastMessage = now
+}
+
+// setReceived records that a message was received, also in the metrics.
+func (s *connState) setReceived(now time.Time) {
+	if s == nil {
+		return
+	}
+	lastMessage.Set(float64(now.Unix()), s.account)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastMessage = now
+}
+
+// setDisconnected records that the connection was closed.
+func (s *connState) setDisconnected() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.connected = false
+	s.subscribed = false
+}
+
+// ready reports whether notes are being received: connected, subscribed
+// and a message was received within idleTimeout. Otherwise it returns the
+// reason.
+func (s *connState) ready(now time.Time, idleTimeout time.Duration) (bool, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case !s.connected:
+		return false, "接続していません"
+	case !s.subscribed:
+		return false, "チャンネルを購読していません"
+	case idleTimeout > 0 && now.Sub(s.lastMessage) > idleTimeout:
+		return false, fmt.Sprintf("最後のメッセージから %s 経過しています", now.Sub(s.lastMessage).Round(time.Second))
+	}
+	return true, ""
+}
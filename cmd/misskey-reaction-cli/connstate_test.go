@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConnStateReady(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		setup    func(s *connState)
+		expected string // 空の場合は準備完了
+	}{
+		{"未接続", func(s *connState) {}, "接続していません"},
+		{"購読前", func(s *connState) { s.setConnected() }, "チャンネルを購読していません"},
+		{"購読直後", func(s *connState) { s.setConnected(); s.setSubscribed(now.Add(-time.Minute)) }, ""},
+		{"メッセージが途絶えた", func(s *connState) {
+			s.setConnected()
+			s.setSubscribed(now.Add(-time.Hour))
+			s.setReceived(now.Add(-15 * time.Minute))
+		}, "最後のメッセージから 15m0s 経過しています"},
+		{"切断", func(s *connState) {
+			s.setConnected()
+			s.setSubscribed(now)
+			s.setDisconnected()
+		}, "接続していません"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &connState{}
+			tt.setup(s)
+			ok, reason := s.ready(now, 10*time.Minute)
+			if ok != (tt.expected == "") || reason != tt.expected {
+				t.Errorf("期待値: %q, 実際: (%v, %q)", tt.expected, ok, reason)
+			}
+		})
+	}
+}
+
+func TestStreamChannels_ConnState(t *testing.T) {
+	server := newMockMisskey(t, `{"emojis":[]}`)
+	server.stream = []note{{ID: "note1", Text: "hello"}}
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/streaming"
+	state := &connState{}
+
+	var readyDuringStream bool
+	streamChannels(wsURL, "testToken", []string{"homeTimeline"}, slog.New(slog.NewTextHandler(io.Discard, nil)), state, nil, nil, func(n note) {
+		readyDuringStream, _ = state.ready(time.Now(), time.Minute)
+	})
+
+	if !readyDuringStream {
+		t.Error("受信中は準備完了であることを期待しました")
+	}
+	if ok, _ := state.ready(time.Now(), time.Minute); ok {
+		t.Error("切断後は準備完了でないことを期待しました")
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// cooldownStore は投稿者ごとにクールダウンが終わる時刻をルール別に保持します。
+type cooldownStore struct {
+	// path が空の場合はメモリ上にのみ保持する
+	path string
+
+	mu    sync.Mutex
+	until map[string]map[string]time.Time // ルール名 -> ユーザーID -> 終了時刻
+}
+
+// newCooldownStore creates a store and loads the saved cooldowns from path
+// when the file exists.
+func newCooldownStore(path string) (*cooldownStore, error) {
+	s := &cooldownStore{path: path, until: make(map[string]map[string]time.Time)}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("クールダウンファイルの読み込みに失敗しました: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.until); err != nil {
+		return nil, fmt.Errorf("クールダウンファイルのパースに失敗しました: %w", err)
+	}
+	return s, nil
+}
+
+// acquire starts a cooldown of d for the user under the rule. When the user
+// is still cooling down, it returns the remaining time and false.
+func (s *cooldownStore) acquire(rule, userID string, d time.Duration, now time.Time) (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users := s.until[rule]
+	if users == nil {
+		users = make(map[string]time.Time)
+		s.until[rule] = users
+	}
+	if until, ok := users[userID]; ok && now.Before(until) {
+		return until.Sub(now), false
+	}
+	users[userID] = now.Add(d)
+	return 0, true
+}
+
+// release cancels the cooldown started by acquire that ends at until, unless
+// another cooldown has replaced it since.
+func (s *cooldownStore) release(rule, userID string, until time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if users := s.until[rule]; users != nil && users[userID].Equal(until) {
+		delete(users, userID)
+	}
+}
+
+// save writes the unexpired cooldowns to the file. It does nothing for an
+// in-memory store.
+func (s *cooldownStore) save(now time.Time) error {
+	if s.path == "" {
+		return nil
+	}
+	s.mu.Lock()
+	for rule, users := range s.until {
+		for userID, until := range users {
+			if !now.Before(until) {
+				delete(users, userID)
+			}
+		}
+		if len(users) == 0 {
+			delete(s.until, rule)
+		}
+	}
+	data, err := json.Marshal(s.until)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(s.path, data)
+}
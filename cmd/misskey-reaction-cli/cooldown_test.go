@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCooldownStore_Acquire(t *testing.T) {
+	s, err := newCooldownStore("")
+	if err != nil {
+		t.Fatalf("作成に失敗しました: %v", err)
+	}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	if _, ok := s.acquire("rule", "user1", 30*time.Minute, now); !ok {
+		t.Fatal("初回は許可されることを期待しました")
+	}
+	remaining, ok := s.acquire("rule", "user1", 30*time.Minute, now.Add(10*time.Minute))
+	if ok || remaining != 20*time.Minute {
+		t.Errorf("残り20分のクールダウンを期待しましたが、実際: %v, %v", remaining, ok)
+	}
+	if _, ok := s.acquire("rule", "user2", 30*time.Minute, now); !ok {
+		t.Error("別のユーザーは許可されることを期待しました")
+	}
+	if _, ok := s.acquire("other", "user1", 30*time.Minute, now); !ok {
+		t.Error("別のルールは許可されることを期待しました")
+	}
+	if _, ok := s.acquire("rule", "user1", 30*time.Minute, now.Add(30*time.Minute)); !ok {
+		t.Error("クールダウン終了後は許可されることを期待しました")
+	}
+}
+
+func TestCooldownStore_Release(t *testing.T) {
+	s, _ := newCooldownStore("")
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	s.acquire("rule", "user1", 30*time.Minute, now)
+	s.release("rule", "user1", now.Add(30*time.Minute))
+	if _, ok := s.acquire("rule", "user1", 30*time.Minute, now.Add(time.Minute)); !ok {
+		t.Error("解除した後は許可されることを期待しました")
+	}
+	// 別のクールダウンに置き換わっている場合は解除しない
+	s.release("rule", "user1", now.Add(30*time.Minute))
+	if _, ok := s.acquire("rule", "user1", 30*time.Minute, now.Add(2*time.Minute)); ok {
+		t.Error("置き換わったクールダウンは解除されないことを期待しました")
+	}
+}
+
+func TestCooldownStore_Persist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cooldown.json")
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	s, err := newCooldownStore(path)
+	if err != nil {
+		t.Fatalf("作成に失敗しました: %v", err)
+	}
+	s.acquire("rule", "user1", time.Hour, now)
+	s.acquire("rule", "expired", time.Minute, now.Add(-time.Hour))
+	if err := s.save(now); err != nil {
+		t.Fatalf("保存に失敗しました: %v", err)
+	}
+
+	// 再起動後も引き継がれる
+	restored, err := newCooldownStore(path)
+	if err != nil {
+		t.Fatalf("読み込みに失敗しました: %v", err)
+	}
+	if _, ok := restored.acquire("rule", "user1", time.Hour, now.Add(time.Minute)); ok {
+		t.Error("保存したクールダウンが引き継がれることを期待しました")
+	}
+	if _, ok := restored.until["rule"]["expired"]; ok {
+		t.Error("期限切れのクールダウンは保存されないことを期待しました")
+	}
+}
+
+func TestNewCooldownStore_InvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cooldown.json")
+	os.WriteFile(path, []byte("invalid json"), 0o644)
+	if _, err := newCooldownStore(path); err == nil {
+		t.Error("不正なファイルでエラーを期待しました")
+	}
+}
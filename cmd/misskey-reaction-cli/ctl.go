@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ctlTimeout は管理APIの呼び出しのタイムアウトです (再読み込みでは絵文字の一覧を取得し直すため長めにする)
+const ctlTimeout = 30 * time.Second
+
+// ctlClient は実行中のbotの管理APIを呼び出します。
+type ctlClient struct {
+	client  *http.Client
+	baseURL string
+	token   string
+}
+
+// newCtlClient returns a client that connects to the Unix socket when it is
+// given, or to the TCP address otherwise.
+func newCtlClient(socket, addr, token string) *ctlClient {
+	if socket != "" {
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		}
+		return &ctlClient{client: &http.Client{Transport: transport, Timeout: ctlTimeout}, baseURL: "http://unix", token: token}
+	}
+	return &ctlClient{client: &http.Client{Timeout: ctlTimeout}, baseURL: "http://" + addr, token: token}
+}
+
+// call sends a request to the admin API and decodes the JSON response into
+// out unless it is nil.
+func (c *ctlClient) call(method, path string, query url.Values, out any) error {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("管理APIに接続できませんでした: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var errResp apiErrorResponse
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil && errResp.Error != "" {
+			return errors.New(errResp.Error)
+		}
+		return fmt.Errorf("管理APIがステータスコード %d を返しました", resp.StatusCode)
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+// runCtl runs the ctl subcommand, which controls a running bot through its
+// admin API.
+func runCtl(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configPath := fs.String("config", "config.yaml", "admin の設定を読み込む設定ファイルのパス")
+	socket := fs.String("socket", "", "管理APIのUnixソケットのパス (省略時は admin.socket)")
+	addr := fs.String("addr", "", "管理APIのアドレス (省略時は admin.listen)")
+	token := fs.String("token", "", "管理APIのトークン (省略時は admin.token)")
+	accountName := fs.String("account", "", "pause, resume の対象のアカウント (省略時はすべて)")
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "使い方: %s ctl [フラグ] <rules|queue|pause [ルール]|resume [ルール]|reload>\n", args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("コマンドが指定されていません")
+	}
+
+	if *socket == "" && *addr == "" || *token == "" {
+		config, err := loadConfig(*configPath)
+		if err != nil && *socket == "" && *addr == "" {
+			fmt.Fprintf(stderr, "設定ファイルの読み込みに失敗しました: %v\n", err)
+			return err
+		}
+		if err == nil {
+			if *socket == "" && *addr == "" {
+				*socket, *addr = config.Admin.Socket, config.Admin.Listen
+			}
+			if *token == "" {
+				*token = config.Admin.Token
+			}
+		}
+	}
+	if *socket == "" && *addr == "" {
+		err := errors.New("管理APIの接続先がありません。admin.socket か admin.listen を設定するか、-socket か -addr を指定してください")
+		fmt.Fprintf(stderr, "エラー: %v\n", err)
+		return err
+	}
+
+	client := newCtlClient(*socket, *addr, *token)
+	if err := runCtlCommand(client, fs.Args(), *accountName, stdout); err != nil {
+		fmt.Fprintf(stderr, "エラー: %v\n", err)
+		return err
+	}
+	return nil
+}
+
+// runCtlCommand calls the admin API for the command and prints the result.
+func runCtlCommand(client *ctlClient, args []string, accountName string, stdout io.Writer) error {
+	switch args[0] {
+	case "rules":
+		var statuses []accountStatus
+		if err := client.call(http.MethodGet, "/api/rules", nil, &statuses); err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			prefix := ""
+			if s.Account != "" {
+				prefix = "アカウント " + s.Account + ": "
+			}
+			state := "動作中"
+			if s.Paused {
+				state = "一時停止中"
+			}
+			fmt.Fprintf(stdout, "%s%s, 処理待ち %d 件\n", prefix, state, s.QueueDepth)
+			for _, rule := range s.Rules {
+				paused := ""
+				if rule.Paused {
+					paused = " (一時停止中)"
+				}
+				fmt.Fprintf(stdout, "  ルール %s: 一致 %d 件, リアクション %d 件%s\n", rule.Name, rule.Matches, rule.Reactions, paused)
+			}
+		}
+	case "queue":
+		var notes []queuedNote
+		if err := client.call(http.MethodGet, "/api/queue", nil, &notes); err != nil {
+			return err
+		}
+		if len(notes) == 0 {
+			fmt.Fprintln(stdout, "処理待ちのノートはありません")
+		}
+		for _, n := range notes {
+			prefix := ""
+			if n.Account != "" {
+				prefix = "[" + n.Account + "] "
+			}
+			fmt.Fprintf(stdout, "%s%s %s (%s): %s\n", prefix, n.ID, n.User, n.Channel, n.Text)
+		}
+	case "pause", "resume":
+		query := url.Values{}
+		target := "bot全体"
+		if len(args) > 1 {
+			query.Set("rule", args[1])
+			target = "ルール " + args[1]
+		}
+		if accountName != "" {
+			query.Set("account", accountName)
+		}
+		if err := client.call(http.MethodPost, "/api/"+args[0], query, nil); err != nil {
+			return err
+		}
+		if args[0] == "pause" {
+			fmt.Fprintf(stdout, "%sを一時停止しました\n", target)
+		} else {
+			fmt.Fprintf(stdout, "%sを再開しました\n", target)
+		}
+	case "reload":
+		if err := client.call(http.MethodPost, "/api/reload", nil, nil); err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, "設定ファイルを再読み込みしました")
+	default:
+		return fmt.Errorf("不明なコマンドです: %s", args[0])
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunCtl(t *testing.T) {
+	server := newMockMisskey(t, `{"emojis":[]}`)
+	a, _, _ := newTestApp(t, fmt.Sprintf(testAppConfig, server.URL, "ctl-greet", "hello"))
+	admin := httptest.NewServer(newAdminHandler(a.config.Admin, a, true))
+	defer admin.Close()
+	addr := strings.TrimPrefix(admin.URL, "http://")
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+		errMsg   string
+	}{
+		{"ルールの一覧", []string{"-token", "secret", "rules"}, "動作中, 処理待ち 0 件\n  ルール ctl-greet: 一致 0 件, リアクション 0 件\n", ""},
+		{"キュー", []string{"-token", "secret", "queue"}, "処理待ちのノートはありません\n", ""},
+		{"ルールの一時停止", []string{"-token", "secret", "pause", "ctl-greet"}, "ルール ctl-greetを一時停止しました\n", ""},
+		{"一時停止後の一覧", []string{"-token", "secret", "rules"}, "  ルール ctl-greet: 一致 0 件, リアクション 0 件 (一時停止中)\n", ""},
+		{"全体の再開", []string{"-token", "secret", "resume"}, "bot全体を再開しました\n", ""},
+		{"誤ったトークン", []string{"-token", "wrong", "rules"}, "", "トークンが正しくありません"},
+		{"存在しないルール", []string{"-token", "secret", "pause", "nope"}, "", "ルール nope は存在しません"},
+		{"不明なコマンド", []string{"-token", "secret", "restart"}, "", "不明なコマンドです: restart"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			err := runCtl(append([]string{"misskey-reaction-cli", "-addr", addr}, tt.args...), &stdout, &stderr)
+
+			if tt.errMsg != "" {
+				if err == nil || !strings.Contains(stderr.String(), tt.errMsg) {
+					t.Errorf("エラー '%s' を期待しましたが、実際: %v, %s", tt.errMsg, err, stderr.String())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("エラーを期待しませんでしたが、実際: %v, %s", err, stderr.String())
+			}
+			if !strings.Contains(stdout.String(), tt.expected) {
+				t.Errorf("出力に %q を期待しましたが、実際: %q", tt.expected, stdout.String())
+			}
+		})
+	}
+}
+
+func TestRunCtl_Socket(t *testing.T) {
+	server := newMockMisskey(t, `{"emojis":[]}`)
+	socket := filepath.Join(t.TempDir(), "admin.sock")
+	a, path, logBuffer := newTestApp(t, fmt.Sprintf(testAppConfig, server.URL, "greet", "hello")+fmt.Sprintf("  socket: %q\n", socket))
+	stop, err := startAdmin(a.config.Admin, a, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("管理用サーバーの起動に失敗しました: %v", err)
+	}
+	defer stop()
+
+	info, err := os.Stat(socket)
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("権限 0600 のソケットを期待しましたが、実際: %v, %v", info, err)
+	}
+
+	// 接続先とトークンは設定ファイルから読み込む
+	var stdout, stderr bytes.Buffer
+	if err := runCtl([]string{"misskey-reaction-cli", "-config", path, "reload"}, &stdout, &stderr); err != nil {
+		t.Fatalf("再読み込みに失敗しました: %v, %s", err, stderr.String())
+	}
+	if stdout.String() != "設定ファイルを再読み込みしました\n" {
+		t.Errorf("再読み込みの完了を期待しましたが、実際: %q", stdout.String())
+	}
+	assertLogLine(t, logBuffer, "設定ファイルを再読み込みしました")
+}
+
+func TestRunCtl_NoAdmin(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte("misskey:\n  url: https://example.com\n"), 0644)
+
+	var stdout, stderr bytes.Buffer
+	err := runCtl([]string{"misskey-reaction-cli", "-config", path, "rules"}, &stdout, &stderr)
+	if err == nil || !strings.Contains(err.Error(), "管理APIの接続先がありません") {
+		t.Errorf("接続先がないエラーを期待しましたが、実際: %v", err)
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"misskey-reaction-cli/internal/emoji"
+)
+
+// 絵文字の選択方式
+const (
+	emojiStrategyRandom     = "random"      // 一様ランダム
+	emojiStrategyWeighted   = "weighted"    // weightに比例したランダム
+	emojiStrategyRoundRobin = "round_robin" // 順番に使う
+	emojiStrategyHash       = "hash"        // ノートIDのハッシュで決める (再起動しても同じ絵文字になる)
+)
+
+// EmojiOption は候補となる絵文字とその重みです。
+type EmojiOption struct {
+	Emoji  string `yaml:"emoji"`
+	Weight int    `yaml:"weight"`
+}
+
+// EmojiSet はルールが付与するリアクションの候補です。
+// YAMLでは1つの文字列、文字列のリスト、または emoji/weight のリストで指定できます。
+type EmojiSet []EmojiOption
+
+// UnmarshalYAML accepts a single emoji, a list of emojis, or a list of
+// emoji/weight pairs.
+func (s *EmojiSet) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var single string
+	if err := unmarshal(&single); err == nil {
+		*s = nil
+		if single != "" {
+			*s = EmojiSet{{Emoji: single}}
+		}
+		return nil
+	}
+
+	var items []interface{}
+	if err := unmarshal(&items); err != nil {
+		return fmt.Errorf("emojiには文字列またはリストを指定してください")
+	}
+	set := make(EmojiSet, 0, len(items))
+	for _, item := range items {
+		switch v := item.(type) {
+		case string:
+			set = append(set, EmojiOption{Emoji: v})
+		case map[interface{}]interface{}:
+			emoji, _ := v["emoji"].(string)
+			weight, _ := v["weight"].(int)
+			set = append(set, EmojiOption{Emoji: emoji, Weight: weight})
+		default:
+			return fmt.Errorf("emojiのリストの要素 %v は不正です", item)
+		}
+	}
+	*s = set
+	return nil
+}
+
+// emojiPicker chooses one emoji from a set for each note.
+type emojiPicker struct {
+	options  EmojiSet
+	strategy string
+	total    int
+	next     atomic.Uint64
+	intn     func(n int) int
+}
+
+// newEmojiPicker validates the set and strategy and returns a picker.
+func newEmojiPicker(set EmojiSet, strategy string) (*emojiPicker, error) {
+	if len(set) == 0 {
+		return nil, fmt.Errorf("絵文字が指定されていません")
+	}
+	switch strategy {
+	case "":
+		strategy = emojiStrategyRandom
+	case emojiStrategyRandom, emojiStrategyWeighted, emojiStrategyRoundRobin, emojiStrategyHash:
+	default:
+		return nil, fmt.Errorf("emoji_strategy %q は不正です", strategy)
+	}
+
+	p := &emojiPicker{options: make(EmojiSet, len(set)), strategy: strategy, intn: rand.Intn}
+	for i, option := range set {
+		if option.Emoji == "" {
+			return nil, fmt.Errorf("%d番目の絵文字が空です", i+1)
+		}
+		if option.Weight < 0 {
+			return nil, fmt.Errorf("絵文字 %s のweightが負の値です", option.Emoji)
+		}
+		// weightの省略時は1とする
+		if option.Weight == 0 {
+			option.Weight = 1
+		}
+		p.options[i] = option
+		p.total += option.Weight
+	}
+	return p, nil
+}
+
+// pick returns the emoji for the given note.
+func (p *emojiPicker) pick(noteID string) string {
+	if len(p.options) == 1 {
+		return p.options[0].Emoji
+	}
+	switch p.strategy {
+	case emojiStrategyWeighted:
+		return p.byWeight(p.intn(p.total))
+	case emojiStrategyRoundRobin:
+		n := p.next.Add(1) - 1
+		return p.options[n%uint64(len(p.options))].Emoji
+	case emojiStrategyHash:
+		h := fnv.New32a()
+		h.Write([]byte(noteID))
+		return p.byWeight(int(h.Sum32() % uint32(p.total)))
+	default:
+		return p.options[p.intn(len(p.options))].Emoji
+	}
+}
+
+// byWeight returns the emoji whose cumulative weight range contains n.
+func (p *emojiPicker) byWeight(n int) string {
+	for _, option := range p.options {
+		if n < option.Weight {
+			return option.Emoji
+		}
+		n -= option.Weight
+	}
+	return p.options[len(p.options)-1].Emoji
+}
+
+// カスタム絵文字が見つからないときの動作
+const (
+	emojiValidationFail     = "fail"     // 起動時はエラー、実行時はスキップ
+	emojiValidationFallback = "fallback" // fallback_emojiを使う
+	emojiValidationOff      = "off"      // 検証しない
+)
+
+// emojisResponse は emojis エンドポイントのレスポンスです。
+type emojisResponse struct {
+	Emojis []struct {
+		Name string `json:"name"`
+	} `json:"emojis"`
+}
+
+// fetchEmojis returns the names of the custom emojis of the instance.
+func fetchEmojis(misskeyURL, token string) ([]string, error) {
+	var resp emojisResponse
+	if err := callAPI(misskeyURL, "emojis", token, struct{}{}, &resp); err != nil {
+		return nil, err
+	}
+	names := make([]string, len(resp.Emojis))
+	for i, e := range resp.Emojis {
+		names[i] = e.Name
+	}
+	return names, nil
+}
+
+// emojiCatalog holds the custom emojis known to the instance.
+type emojiCatalog struct {
+	fetch func() ([]string, error)
+
+	mu    sync.RWMutex
+	names map[string]bool
+}
+
+func newEmojiCatalog(fetch func() ([]string, error)) *emojiCatalog {
+	return &emojiCatalog{fetch: fetch}
+}
+
+// refresh reloads the emoji list. The previous list is kept on failure.
+func (c *emojiCatalog) refresh() error {
+	list, err := c.fetch()
+	if err != nil {
+		return err
+	}
+	names := make(map[string]bool, len(list))
+	for _, name := range list {
+		names[name] = true
+	}
+	c.mu.Lock()
+	c.names = names
+	c.mu.Unlock()
+	return nil
+}
+
+// refreshEvery refreshes the list at the given interval until stop is closed.
+func (c *emojiCatalog) refreshEvery(interval time.Duration, logger *slog.Logger, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.refresh(); err != nil {
+				logger.Warn("カスタム絵文字の一覧の更新に失敗しました", errorAttrs(err)...)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// check returns an error when reaction is a custom emoji that cannot be used
+// for a reaction: a remote emoji (":name@host:"), which Misskey does not
+// accept, or a local one that does not exist on the instance. Unicode emojis
+// and local emojis checked before the list has been loaded are accepted.
+func (c *emojiCatalog) check(reaction string) error {
+	name, host, ok := emoji.ParseCustom(reaction)
+	if !ok {
+		return nil
+	}
+	if host != "" && host != "." {
+		return fmt.Errorf("リモートのカスタム絵文字 %s はリアクションに使えません", reaction)
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.names == nil || c.names[name] {
+		return nil
+	}
+	return fmt.Errorf("カスタム絵文字 %s はインスタンスに存在しません", reaction)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestEmojiSet_UnmarshalYAML(t *testing.T) {
+	tests := []struct {
+		name     string
+		yaml     string
+		expected EmojiSet
+	}{
+		{"単一", `emoji: "👍"`, EmojiSet{{Emoji: "👍"}}},
+		{"リスト", `emoji: ["👍", ":awesome:"]`, EmojiSet{{Emoji: "👍"}, {Emoji: ":awesome:"}}},
+		{"重み付き", "emoji:\n  - emoji: \"👍\"\n    weight: 3\n  - \"🎉\"", EmojiSet{{Emoji: "👍", Weight: 3}, {Emoji: "🎉"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rule Rule
+			if err := yaml.Unmarshal([]byte(tt.yaml), &rule); err != nil {
+				t.Fatalf("パースに失敗しました: %v", err)
+			}
+			if !reflect.DeepEqual(rule.Emoji, tt.expected) {
+				t.Errorf("期待値: %+v, 実際: %+v", tt.expected, rule.Emoji)
+			}
+		})
+	}
+}
+
+func TestNewEmojiPicker_Error(t *testing.T) {
+	tests := []struct {
+		name     string
+		set      EmojiSet
+		strategy string
+		expected string
+	}{
+		{"空", nil, "", "絵文字が指定されていません"},
+		{"不正な方式", EmojiSet{{Emoji: "👍"}}, "invalid", "emoji_strategy"},
+		{"空の絵文字", EmojiSet{{Emoji: "👍"}, {}}, "", "2番目の絵文字が空です"},
+		{"負の重み", EmojiSet{{Emoji: "👍", Weight: -1}}, "weighted", "weightが負の値です"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newEmojiPicker(tt.set, tt.strategy)
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("エラー '%s' を期待しましたが、実際: %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestEmojiPicker_Pick(t *testing.T) {
+	set := EmojiSet{{Emoji: "👍", Weight: 3}, {Emoji: "🎉"}}
+
+	t.Run("ラウンドロビン", func(t *testing.T) {
+		p, _ := newEmojiPicker(set, emojiStrategyRoundRobin)
+		var got []string
+		for i := 0; i < 4; i++ {
+			got = append(got, p.pick("note"))
+		}
+		expected := []string{"👍", "🎉", "👍", "🎉"}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("期待値: %v, 実際: %v", expected, got)
+		}
+	})
+
+	t.Run("重み付き", func(t *testing.T) {
+		p, _ := newEmojiPicker(set, emojiStrategyWeighted)
+		for n, expected := range []string{"👍", "👍", "👍", "🎉"} {
+			p.intn = func(int) int { return n }
+			if got := p.pick("note"); got != expected {
+				t.Errorf("乱数 %d で %s を期待しましたが、実際: %s", n, expected, got)
+			}
+		}
+	})
+
+	t.Run("一様ランダム", func(t *testing.T) {
+		p, _ := newEmojiPicker(set, emojiStrategyRandom)
+		p.intn = func(n int) int { return n - 1 }
+		if got := p.pick("note"); got != "🎉" {
+			t.Errorf("重みを無視して最後の絵文字を期待しましたが、実際: %s", got)
+		}
+	})
+
+	t.Run("ハッシュは同じノートで同じ絵文字", func(t *testing.T) {
+		p1, _ := newEmojiPicker(set, emojiStrategyHash)
+		p2, _ := newEmojiPicker(set, emojiStrategyHash)
+		for _, id := range []string{"9abc", "9abd", "a1b2c3", "zzz"} {
+			if p1.pick(id) != p2.pick(id) {
+				t.Errorf("ノートID %s で結果が変わりました", id)
+			}
+		}
+	})
+
+	t.Run("単一の絵文字", func(t *testing.T) {
+		p, _ := newEmojiPicker(EmojiSet{{Emoji: "👍"}}, emojiStrategyRoundRobin)
+		if got := p.pick("note"); got != "👍" {
+			t.Errorf("期待値: 👍, 実際: %s", got)
+		}
+	})
+}
+
+func TestFetchEmojis(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/emojis" {
+			t.Errorf("パス /api/emojis を期待しましたが、%sが来ました", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"emojis":[{"name":"awesome","aliases":["a"]},{"name":"blobcat"}]}`))
+	}))
+	defer server.Close()
+
+	names, err := fetchEmojis(server.URL, "testToken")
+	if err != nil {
+		t.Fatalf("エラーが発生しないことを期待しましたが、発生しました: %v", err)
+	}
+	if !reflect.DeepEqual(names, []string{"awesome", "blobcat"}) {
+		t.Errorf("期待値: [awesome blobcat], 実際: %v", names)
+	}
+}
+
+func TestEmojiCatalog_Check(t *testing.T) {
+	catalog := newEmojiCatalog(func() ([]string, error) { return []string{"awesome"}, nil })
+
+	// 読み込み前はローカルの絵文字を検証しない
+	if err := catalog.check(":awsome:"); err != nil {
+		t.Errorf("読み込み前はエラーにならないことを期待しましたが、実際: %v", err)
+	}
+	if err := catalog.check(":awesome@misskey.io:"); err == nil || !strings.Contains(err.Error(), "リモートのカスタム絵文字 :awesome@misskey.io: はリアクションに使えません") {
+		t.Errorf("読み込み前でもリモートの絵文字はエラーを期待しましたが、実際: %v", err)
+	}
+	if err := catalog.refresh(); err != nil {
+		t.Fatalf("更新に失敗しました: %v", err)
+	}
+
+	tests := []struct {
+		reaction  string
+		expectErr bool
+	}{
+		{":awesome:", false},
+		{":awesome@.:", false},
+		{":awsome:", true},
+		{":awsome@.:", true},
+		{":awesome@misskey.io:", true}, // リモートの絵文字はリアクションに使えない
+		{"👍", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.reaction, func(t *testing.T) {
+			if err := catalog.check(tt.reaction); (err != nil) != tt.expectErr {
+				t.Errorf("エラーの有無の期待値: %v, 実際: %v", tt.expectErr, err)
+			}
+		})
+	}
+
+	// 更新に失敗した場合は前回の一覧を使い続ける
+	catalog.fetch = func() ([]string, error) { return nil, errors.New("network error") }
+	if err := catalog.refresh(); err == nil {
+		t.Error("更新のエラーを期待しましたが、発生しませんでした")
+	}
+	if err := catalog.check(":awsome:"); err == nil {
+		t.Error("前回の一覧で検証されることを期待しました")
+	}
+}
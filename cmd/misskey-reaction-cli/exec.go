@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"misskey-reaction-cli/internal/emoji"
+)
+
+// defaultExecTimeout は exec の timeout が省略されたときの値です。
+const defaultExecTimeout = 30 * time.Second
+
+// execLogLimit はログに出力するコマンドの出力の最大文字数です。
+const execLogLimit = 1000
+
+// execOutputLimit は標準出力と標準エラー出力のそれぞれについて保持する最大バイト数です。
+const execOutputLimit = 64 * 1024
+
+// execWaitDelay はタイムアウトでコマンドを停止した後、子プロセスが出力を閉じるまで待つ時間です。
+const execWaitDelay = time.Second
+
+// checkExec validates the exec settings of the action and prepares the
+// concurrency limit.
+func checkExec(action *Action) error {
+	if len(action.Command) == 0 || action.Command[0] == "" {
+		return fmt.Errorf("exec にcommandが指定されていません")
+	}
+	if action.Timeout < 0 {
+		return fmt.Errorf("exec のtimeoutに負の値は指定できません")
+	}
+	if action.MaxConcurrency < 0 {
+		return fmt.Errorf("exec のmax_concurrencyに負の値は指定できません")
+	}
+	limit := action.MaxConcurrency
+	if limit == 0 {
+		limit = 1
+	}
+	action.slots = make(chan struct{}, limit)
+	return nil
+}
+
+// runExec runs the action's command with the note as JSON on stdin and logs
+// its output. The command runs in the background once one of the action's
+// max_concurrency slots is free, so that a slow command does not hold up the
+// following notes. When use_output_as_reaction is set, runExec waits for the
+// command instead and returns the emoji it prints to be used as the reaction.
+func (b *bot) runExec(n note, rule *Rule, action Action) string {
+	command := strings.Join(action.Command, " ")
+	logger := b.noteLogger(n, rule).With(logKeyAction, actionExec, "command", command)
+	if b.config.DryRun {
+		logger.Info("ドライラン: アクションを実行します")
+		return ""
+	}
+
+	// 枠が空くまではノートの処理を待たせる
+	select {
+	case action.slots <- struct{}{}:
+	default:
+		logger.Debug("コマンドの同時実行数の上限に達したため、空きを待ちます", "max_concurrency", cap(action.slots))
+		action.slots <- struct{}{}
+	}
+	if !action.UseOutputAsReaction {
+		b.execs.Add(1)
+		go func() {
+			defer b.execs.Done()
+			defer func() { <-action.slots }()
+			b.execCommand(logger, n, rule, action)
+		}()
+		return ""
+	}
+	defer func() { <-action.slots }()
+
+	out, ok := b.execCommand(logger, n, rule, action)
+	if !ok || out == "" {
+		return ""
+	}
+	if !emoji.IsUnicode(out) && !emoji.IsCustom(out) {
+		logger.Warn("コマンドの出力が絵文字ではないため、リアクションには使いません", "output", truncate(execLogLimit, out))
+		return ""
+	}
+	return out
+}
+
+// execCommand runs the command and logs its output and result. It returns
+// the trimmed standard output and whether the command succeeded.
+func (b *bot) execCommand(logger *slog.Logger, n note, rule *Rule, action Action) (string, bool) {
+	payload := b.payload(n, rule)
+	input, err := json.Marshal(payload)
+	if err != nil {
+		logger.Error("コマンドの入力の作成に失敗しました", errorAttrs(err)...)
+		return "", false
+	}
+
+	timeout := action.Timeout
+	if timeout == 0 {
+		timeout = defaultExecTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, action.Command[0], action.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Env = append(os.Environ(),
+		"MISSKEY_NOTE_ID="+n.ID,
+		"MISSKEY_NOTE_URL="+payload.NoteURL,
+		"MISSKEY_USER_ID="+n.User.ID,
+		"MISSKEY_USERNAME="+n.User.Username,
+		"MISSKEY_USER_HOST="+n.User.Host,
+		"MISSKEY_RULE="+rule.Name,
+		"MISSKEY_MATCHED_TEXT="+payload.MatchedText,
+	)
+	// 停止したコマンドの子プロセスが出力を開いたままでも、待ち続けないようにする
+	cmd.WaitDelay = execWaitDelay
+	stdout, stderr := &limitedBuffer{limit: execOutputLimit}, &limitedBuffer{limit: execOutputLimit}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	logger.Debug("コマンドを実行します")
+	start := time.Now()
+	err = cmd.Run()
+	logger = logger.With(logKeyLatency, time.Since(start).Round(time.Millisecond).String())
+
+	if out := strings.TrimSpace(stdout.String()); out != "" {
+		logger.Info("コマンドの標準出力", "output", truncate(execLogLimit, out))
+	}
+	if out := strings.TrimSpace(stderr.String()); out != "" {
+		logger.Info("コマンドの標準エラー出力", "output", truncate(execLogLimit, out))
+	}
+
+	if errors.Is(err, exec.ErrWaitDelay) && ctx.Err() == nil {
+		// コマンド自体は正常終了している
+		logger.Warn("コマンドの終了後も子プロセスが出力を閉じていなかったため、出力の読み込みをやめました")
+		err = nil
+	}
+	var exitErr *exec.ExitError
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		logger.Error("コマンドがタイムアウトしたため停止しました", "timeout", timeout.String())
+		return "", false
+	case errors.As(err, &exitErr):
+		logger.Error("コマンドが異常終了しました", "exit_code", exitErr.ExitCode())
+		return "", false
+	case err != nil:
+		logger.Error("コマンドを実行できませんでした", errorAttrs(err)...)
+		return "", false
+	}
+	logger.Info("アクションを実行しました")
+	return strings.TrimSpace(stdout.String()), true
+}
+
+// limitedBuffer keeps the first limit bytes written to it and discards the
+// rest, so that a command printing a lot does not use up memory.
+type limitedBuffer struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if rest := b.limit - b.buf.Len(); rest > 0 {
+		b.buf.Write(p[:min(len(p), rest)])
+	}
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
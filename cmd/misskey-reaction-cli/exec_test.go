@@ -0,0 +1,200 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrepareActions_ExecError(t *testing.T) {
+	tests := []struct {
+		name     string
+		action   Action
+		expected string
+	}{
+		{"コマンドなし", Action{Type: actionExec}, "commandが指定されていません"},
+		{"負のタイムアウト", Action{Type: actionExec, Command: []string{"true"}, Timeout: -time.Second}, "timeoutに負の値"},
+		{"負の同時実行数", Action{Type: actionExec, Command: []string{"true"}, MaxConcurrency: -1}, "max_concurrencyに負の値"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := prepareRules([]Rule{{MatchText: "a", Actions: []Action{tt.action}}})
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("エラー '%s' を期待しましたが、実際: %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestBotRunExec(t *testing.T) {
+	tests := []struct {
+		name     string
+		action   Action
+		expected [][]string // 各要素をすべて含む行がログにあること
+	}{
+		{
+			"標準入力と環境変数",
+			Action{Command: []string{"sh", "-c", `cat; echo; echo "$MISSKEY_RULE $MISSKEY_USERNAME $MISSKEY_NOTE_ID" >&2`}},
+			[][]string{
+				{"コマンドの標準出力", `\"rule\":\"greet\",\"matched_text\":\"hello\"`, `command="sh -c`},
+				{"コマンドの標準エラー出力", "greet alice note1"},
+			},
+		},
+		{
+			"終了コード",
+			Action{Command: []string{"sh", "-c", "exit 3"}},
+			[][]string{{"level=ERROR", "コマンドが異常終了しました", "exit_code=3"}},
+		},
+		{
+			"タイムアウト",
+			Action{Command: []string{"sleep", "1"}, Timeout: 50 * time.Millisecond},
+			[][]string{{"level=ERROR", "コマンドがタイムアウトしたため停止しました", `command="sleep 1"`, "timeout=50ms"}},
+		},
+		{
+			"出力を開いたままの子プロセス",
+			Action{Command: []string{"sh", "-c", "sleep 3; echo"}, Timeout: 50 * time.Millisecond},
+			[][]string{{"level=ERROR", "コマンドがタイムアウトしたため停止しました", "timeout=50ms"}},
+		},
+		{
+			"存在しないコマンド",
+			Action{Command: []string{"/nonexistent/command"}},
+			[][]string{{"level=ERROR", "コマンドを実行できませんでした", "command=/nonexistent/command"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newMockMisskey(t, `{"emojis":[]}`)
+			b, logBuffer := newTestBot(t, testConfig(server.URL, Rule{MatchText: "hello"}))
+			action := tt.action
+			action.Type = actionExec
+			if err := checkExec(&action); err != nil {
+				t.Fatalf("設定の検証に失敗しました: %v", err)
+			}
+
+			start := time.Now()
+			b.runExec(note{ID: "note1", Text: "hello", User: noteUser{Username: "alice"}}, &Rule{Name: "greet", MatchText: "hello"}, action)
+			b.execs.Wait()
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("タイムアウトの後すぐに戻ることを期待しましたが、実際: %v", elapsed)
+			}
+
+			for _, expected := range tt.expected {
+				assertLogLine(t, logBuffer, expected...)
+			}
+		})
+	}
+}
+
+func TestBotHandleNote_ExecConcurrency(t *testing.T) {
+	server := newMockMisskey(t, `{"emojis":[]}`)
+	dir := t.TempDir()
+	// release ができるまで終わらないコマンド
+	script := `touch "$0/$MISSKEY_NOTE_ID"; while [ ! -f "$0/release" ]; do sleep 0.01; done`
+	b, logBuffer := newTestBot(t, testConfig(server.URL, Rule{MatchText: "hello", Actions: []Action{
+		{Type: actionExec, Command: []string{"sh", "-c", script, dir}, MaxConcurrency: 2},
+	}}))
+
+	// 枠が空いている間は、コマンドの終了を待たずに次のノートを処理する
+	b.handleNote(note{ID: "note1", Text: "hello"})
+	b.handleNote(note{ID: "note2", Text: "hello"})
+	waitForFile(t, filepath.Join(dir, "note1"))
+	waitForFile(t, filepath.Join(dir, "note2"))
+
+	// 枠が埋まっている間は、空くまでノートの処理を待つ
+	done := make(chan struct{})
+	go func() {
+		b.handleNote(note{ID: "note3", Text: "hello"})
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("枠が空くまで待つことを期待しました")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if _, err := os.Stat(filepath.Join(dir, "note3")); err == nil {
+		t.Error("max_concurrencyを超えてコマンドを実行しています")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "release"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("枠が空いたらコマンドを実行することを期待しました")
+	}
+	b.execs.Wait()
+
+	for _, id := range []string{"note1", "note2", "note3"} {
+		assertLogLine(t, logBuffer, "アクションを実行しました", "note_id="+id, "action=exec")
+	}
+}
+
+// waitForFile はpathが作られるまで待ちます。
+func waitForFile(t *testing.T, path string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s が作られませんでした", path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPrepareRules_ExecSlotsPerAccount(t *testing.T) {
+	rules := []Rule{{MatchText: "a", Actions: []Action{{Type: actionExec, Command: []string{"true"}}}}}
+	first, _ := prepareRules(rules)
+	second, _ := prepareRules(rules)
+
+	// 同じルールの設定を引き継いだアカウントでも、同時実行数の制限は別々
+	if first[0].Actions[0].slots == second[0].Actions[0].slots {
+		t.Error("アカウントごとに別の同時実行数の制限を期待しました")
+	}
+	if rules[0].Actions[0].slots != nil {
+		t.Error("元の設定を変更しないことを期待しました")
+	}
+}
+
+func TestLimitedBuffer(t *testing.T) {
+	b := &limitedBuffer{limit: 5}
+	for _, s := range []string{"abc", "defg", "hij"} {
+		if n, err := b.Write([]byte(s)); n != len(s) || err != nil {
+			t.Errorf("書き込んだ長さ %d を期待しましたが、実際: %d, %v", len(s), n, err)
+		}
+	}
+	if b.String() != "abcde" {
+		t.Errorf("先頭の5バイトを期待しましたが、実際: %q", b.String())
+	}
+}
+
+func TestBotHandleNote_ExecOutputAsReaction(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		expected string
+	}{
+		{"絵文字", "🎉", "🎉"},
+		{"絵文字以外", "hello", "👍"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newMockMisskey(t, `{"emojis":[]}`)
+			b, _ := newTestBot(t, testConfig(server.URL, Rule{MatchText: "hello", Actions: []Action{
+				{Type: actionExec, Command: []string{"echo", tt.output}, UseOutputAsReaction: true},
+				{Type: actionReaction},
+			}}))
+
+			b.handleNote(note{ID: "note1", Text: "hello"})
+
+			if reactions := server.sentReactions(); len(reactions) != 1 || reactions[0].Reaction != tt.expected {
+				t.Errorf("%s のリアクションを期待しましたが、実際: %+v", tt.expected, reactions)
+			}
+		})
+	}
+}
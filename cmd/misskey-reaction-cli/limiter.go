@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// RateLimitConfig はリアクションの頻度制限の設定です。0の項目は制限しません。
+type RateLimitConfig struct {
+	// PerMinute は1分あたりに補充されるトークン数 (トークンバケット)
+	PerMinute float64 `yaml:"per_minute"`
+	// Burst はバケットの容量 (連続して投稿できる数)。省略時は1
+	Burst int `yaml:"burst"`
+	// PerHour, PerDay は1時間・1日あたりの上限
+	PerHour int `yaml:"per_hour"`
+	PerDay  int `yaml:"per_day"`
+	// Timezone は1時間・1日の区切りに使うタイムゾーン (例: Asia/Tokyo)。省略時はローカル時刻
+	Timezone string `yaml:"timezone"`
+}
+
+// rateLimiter combines a token bucket with hourly and daily quotas.
+type rateLimiter struct {
+	bucket *tokenBucket
+	hourly *quota
+	daily  *quota
+}
+
+// newRateLimiter returns nil when the config has no limits.
+func newRateLimiter(c RateLimitConfig) (*rateLimiter, error) {
+	if c.PerMinute < 0 || c.Burst < 0 || c.PerHour < 0 || c.PerDay < 0 {
+		return nil, fmt.Errorf("rate_limitに負の値は指定できません")
+	}
+	if c.PerMinute == 0 && c.PerHour == 0 && c.PerDay == 0 {
+		return nil, nil
+	}
+	loc := time.Local
+	if c.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(c.Timezone); err != nil {
+			return nil, fmt.Errorf("rate_limit.timezone %q は不正です: %w", c.Timezone, err)
+		}
+	}
+
+	l := &rateLimiter{}
+	if c.PerMinute > 0 {
+		burst := c.Burst
+		if burst == 0 {
+			burst = 1
+		}
+		l.bucket = &tokenBucket{rate: c.PerMinute / 60, burst: float64(burst), tokens: float64(burst)}
+	}
+	if c.PerHour > 0 {
+		l.hourly = &quota{limit: c.PerHour, name: "1時間", loc: loc, window: truncateHour, next: nextHour}
+	}
+	if c.PerDay > 0 {
+		l.daily = &quota{limit: c.PerDay, name: "1日", loc: loc, window: truncateDay, next: nextDay}
+	}
+	return l, nil
+}
+
+// check returns an error describing the limit that would be exceeded by one
+// more reaction at now.
+func (l *rateLimiter) check(now time.Time) error {
+	if l == nil {
+		return nil
+	}
+	if l.bucket != nil && !l.bucket.available(now) {
+		return fmt.Errorf("1分あたり %g 件の頻度制限に達しました", l.bucket.rate*60)
+	}
+	for _, q := range []*quota{l.hourly, l.daily} {
+		if q != nil && !q.available(now) {
+			return fmt.Errorf("%sの上限 %d 件に達しました (リセット: %s)", q.name, q.limit, q.reset(now).Format("2006-01-02 15:04 MST"))
+		}
+	}
+	return nil
+}
+
+// consume records one reaction at now.
+func (l *rateLimiter) consume(now time.Time) {
+	if l == nil {
+		return
+	}
+	if l.bucket != nil {
+		l.bucket.take(now)
+	}
+	for _, q := range []*quota{l.hourly, l.daily} {
+		if q != nil {
+			q.take(now)
+		}
+	}
+}
+
+// tokenBucket は一定の速度でトークンが補充されるバケットです。
+type tokenBucket struct {
+	rate   float64 // 1秒あたりの補充数
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if !b.last.IsZero() {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+}
+
+func (b *tokenBucket) available(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= 1
+}
+
+func (b *tokenBucket) take(now time.Time) {
+	b.refill(now)
+	b.tokens--
+}
+
+// quota は時間枠ごとの件数の上限です。
+type quota struct {
+	limit  int
+	name   string
+	loc    *time.Location
+	window func(t time.Time) time.Time
+	next   func(start time.Time) time.Time
+
+	start time.Time
+	count int
+}
+
+func (q *quota) roll(now time.Time) {
+	if start := q.window(now.In(q.loc)); !start.Equal(q.start) {
+		q.start = start
+		q.count = 0
+	}
+}
+
+func (q *quota) available(now time.Time) bool {
+	q.roll(now)
+	return q.count < q.limit
+}
+
+func (q *quota) take(now time.Time) {
+	q.roll(now)
+	q.count++
+}
+
+// reset returns the time at which the current window ends.
+func (q *quota) reset(now time.Time) time.Time {
+	return q.next(q.window(now.In(q.loc)))
+}
+
+func truncateHour(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+}
+
+func truncateDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func nextHour(start time.Time) time.Time { return start.Add(time.Hour) }
+
+func nextDay(start time.Time) time.Time { return start.AddDate(0, 0, 1) }
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_TokenBucket(t *testing.T) {
+	l, err := newRateLimiter(RateLimitConfig{PerMinute: 2, Burst: 2})
+	if err != nil {
+		t.Fatalf("作成に失敗しました: %v", err)
+	}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// バーストの分だけ連続して許可される
+	for i := 0; i < 2; i++ {
+		if err := l.check(now); err != nil {
+			t.Fatalf("%d回目は許可されることを期待しましたが、実際: %v", i+1, err)
+		}
+		l.consume(now)
+	}
+	if err := l.check(now); err == nil || !strings.Contains(err.Error(), "1分あたり 2 件") {
+		t.Errorf("頻度制限のエラーを期待しましたが、実際: %v", err)
+	}
+
+	// 30秒で1トークン補充される
+	if err := l.check(now.Add(29 * time.Second)); err == nil {
+		t.Error("29秒後はまだ制限されることを期待しました")
+	}
+	if err := l.check(now.Add(30 * time.Second)); err != nil {
+		t.Errorf("30秒後は許可されることを期待しましたが、実際: %v", err)
+	}
+}
+
+func TestRateLimiter_DailyQuotaTimezone(t *testing.T) {
+	l, err := newRateLimiter(RateLimitConfig{PerDay: 2, Timezone: "Asia/Tokyo"})
+	if err != nil {
+		t.Fatalf("作成に失敗しました: %v", err)
+	}
+	// 2024-01-01 23:30 JST
+	now := time.Date(2024, 1, 1, 14, 30, 0, 0, time.UTC)
+	l.consume(now)
+	l.consume(now)
+
+	err = l.check(now)
+	if err == nil {
+		t.Fatal("1日の上限のエラーを期待しましたが、発生しませんでした")
+	}
+	if expected := "1日の上限 2 件に達しました (リセット: 2024-01-02 00:00 JST)"; !strings.Contains(err.Error(), expected) {
+		t.Errorf("エラー '%s' を期待しましたが、実際: %v", expected, err)
+	}
+
+	// JSTの0時 (UTCの15時) にリセットされる
+	if err := l.check(now.Add(30 * time.Minute)); err != nil {
+		t.Errorf("日付が変わった後は許可されることを期待しましたが、実際: %v", err)
+	}
+}
+
+func TestRateLimiter_HourlyQuota(t *testing.T) {
+	l, _ := newRateLimiter(RateLimitConfig{PerHour: 1, Timezone: "UTC"})
+	now := time.Date(2024, 1, 1, 12, 59, 0, 0, time.UTC)
+	l.consume(now)
+	if err := l.check(now); err == nil || !strings.Contains(err.Error(), "1時間の上限 1 件") {
+		t.Errorf("1時間の上限のエラーを期待しましたが、実際: %v", err)
+	}
+	if err := l.check(now.Add(time.Minute)); err != nil {
+		t.Errorf("次の時間帯は許可されることを期待しましたが、実際: %v", err)
+	}
+}
+
+func TestNewRateLimiter(t *testing.T) {
+	if l, err := newRateLimiter(RateLimitConfig{}); l != nil || err != nil {
+		t.Errorf("制限なしの場合はnilを期待しましたが、実際: %v, %v", l, err)
+	}
+	if _, err := newRateLimiter(RateLimitConfig{PerDay: 1, Timezone: "Invalid/Zone"}); err == nil {
+		t.Error("不正なタイムゾーンでエラーを期待しました")
+	}
+	if _, err := newRateLimiter(RateLimitConfig{PerHour: -1}); err == nil {
+		t.Error("負の値でエラーを期待しました")
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// ログの共通のキー。ノートに関するイベントには同じキーを使う
+const (
+	logKeyNoteID    = "note_id"
+	logKeyRule      = "rule"
+	logKeyEmoji     = "emoji"
+	logKeyUser      = "user"
+	logKeyNoteAge   = "note_age"
+	logKeyLatency   = "latency"
+	logKeyErrorCode = "error_code"
+	logKeyError     = "error"
+	logKeyAction    = "action"
+	logKeyAccount   = "account"
+)
+
+// newLogger creates a logger writing to w in the given format ("text" or
+// "json") at the given minimum level ("debug", "info", "warn" or "error").
+func newLogger(w io.Writer, format, level string) (*slog.Logger, error) {
+	var lv slog.Level
+	switch strings.ToLower(level) {
+	case "debug":
+		lv = slog.LevelDebug
+	case "", "info":
+		lv = slog.LevelInfo
+	case "warn":
+		lv = slog.LevelWarn
+	case "error":
+		lv = slog.LevelError
+	default:
+		return nil, fmt.Errorf("log_level %q は不正です (debug, info, warn, error のいずれかを指定してください)", level)
+	}
+	opts := &slog.HandlerOptions{Level: lv}
+	switch format {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("log_format %q は不正です (text または json を指定してください)", format)
+	}
+}
+
+// errorAttrs returns the error and, for Misskey API errors, its code.
+func errorAttrs(err error) []any {
+	attrs := []any{logKeyError, err.Error()}
+	var apiErr *apiError
+	if errors.As(err, &apiErr) && apiErr.Code != "" {
+		attrs = append(attrs, logKeyErrorCode, apiErr.Code)
+	}
+	return attrs
+}
+
+// noteLogger returns a logger carrying the fields that identify the note and
+// the rule it matched, and the age of the note at the time of the decision.
+func (b *bot) noteLogger(n note, rule *Rule) *slog.Logger {
+	user := n.User.ID
+	if n.User.Username != "" {
+		user = n.User.acct()
+	}
+	if user == "" {
+		user = n.UserID
+	}
+	return b.logger.With(logKeyNoteID, n.ID, logKeyRule, rule.Name, logKeyUser, user, logKeyNoteAge, b.noteAge(n).String())
+}
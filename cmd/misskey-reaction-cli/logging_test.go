@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestNewLogger(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		level    string
+		expected []string
+		excluded []string
+	}{
+		{"デフォルト", "", "", []string{"level=INFO msg=情報", "level=WARN msg=警告"}, []string{"デバッグ"}},
+		{"debugレベル", "text", "debug", []string{"level=DEBUG msg=デバッグ", "level=INFO msg=情報"}, nil},
+		{"warnレベル", "text", "WARN", []string{"level=WARN msg=警告"}, []string{"情報", "デバッグ"}},
+		{"json形式", "json", "info", []string{`"level":"INFO","msg":"情報"`, `"note_id":"note1"`}, []string{"デバッグ"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger, err := newLogger(&buf, tt.format, tt.level)
+			if err != nil {
+				t.Fatalf("ロガーの作成に失敗しました: %v", err)
+			}
+			logger.Debug("デバッグ")
+			logger.Info("情報", logKeyNoteID, "note1")
+			logger.Warn("警告")
+
+			for _, expected := range tt.expected {
+				if !strings.Contains(buf.String(), expected) {
+					t.Errorf("ログに '%s' が含まれていませんでした: %s", expected, buf.String())
+				}
+			}
+			for _, excluded := range tt.excluded {
+				if strings.Contains(buf.String(), excluded) {
+					t.Errorf("ログに '%s' が含まれないことを期待しました: %s", excluded, buf.String())
+				}
+			}
+		})
+	}
+}
+
+func TestNewLogger_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		level    string
+		expected string
+	}{
+		{"不正な形式", "xml", "", `log_format "xml" は不正です`},
+		{"不正なレベル", "", "verbose", `log_level "verbose" は不正です`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newLogger(&bytes.Buffer{}, tt.format, tt.level); err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("エラー '%s' を期待しましたが、実際: %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestBotHandleNote_JSONLog(t *testing.T) {
+	server := newMockMisskey(t, `{"emojis":[]}`)
+	server.reactionErrorCode = "ALREADY_REACTED"
+	b, _ := newTestBot(t, testConfig(server.URL, Rule{Name: "greet", MatchText: "hello"}))
+	var buf bytes.Buffer
+	b.logger, _ = newLogger(&buf, "json", "info")
+
+	b.handleNote(note{ID: "note1", Text: "hello", User: noteUser{ID: "u1", Username: "alice"}})
+
+	var entry map[string]any
+	if err := json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &entry); err != nil {
+		t.Fatalf("ログの1行をJSONとしてパースできませんでした: %v: %s", err, buf.String())
+	}
+	for key, expected := range map[string]string{
+		"msg":           "スキップ: 既にリアクション済みでした",
+		logKeyNoteID:    "note1",
+		logKeyRule:      "greet",
+		logKeyUser:      "@alice",
+		logKeyEmoji:     "👍",
+		logKeyAction:    "reaction",
+		logKeyErrorCode: "ALREADY_REACTED",
+	} {
+		if entry[key] != expected {
+			t.Errorf("%s に %q を期待しましたが、実際: %v", key, expected, entry[key])
+		}
+	}
+	if _, ok := entry[logKeyLatency]; !ok {
+		t.Errorf("ログに %s が含まれていませんでした: %v", logKeyLatency, entry)
+	}
+}
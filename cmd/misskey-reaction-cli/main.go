@@ -3,18 +3,22 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"log"
-	"math/rand"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/websocket"
 	yaml "gopkg.in/yaml.v2"
+
+	"misskey-reaction-cli/internal/logrotate"
 )
 
 // Misskey APIへのリクエストボディ
@@ -31,20 +35,85 @@ type misskeyErrorResponse struct {
 	}
 }
 
+// MisskeyConfig はMisskeyインスタンスへの接続設定です。
+type MisskeyConfig struct {
+	URL   string `yaml:"url"`
+	Token string `yaml:"token"`
+	// Channel は購読するタイムラインのチャンネル (省略時はhomeTimeline)
+	Channel string `yaml:"channel"`
+	// Channels を指定すると複数のチャンネルを1つの接続で購読する (Channelより優先)
+	Channels []string `yaml:"channels"`
+}
+
 // Config struct to hold application settings
 type Config struct {
 	LogPath string `yaml:"log_path"`
-	Misskey struct {
-		URL   string `yaml:"url"`
-		Token string `yaml:"token"`
-	} `yaml:"misskey"`
-	Reaction struct {
+	// LogFormat はログの形式 (text または json)。省略時はtext
+	LogFormat string `yaml:"log_format"`
+	// LogLevel は出力するログの最小レベル (debug, info, warn, error)。省略時はinfo
+	LogLevel string `yaml:"log_level"`
+	// LogRotate はlog_pathのローテートの設定
+	LogRotate logrotate.Options `yaml:"log_rotate"`
+	Misskey   MisskeyConfig     `yaml:"misskey"`
+	Reaction  struct {
 		Emoji     string `yaml:"emoji"`
 		MatchText string `yaml:"match_text"`
 		MatchType string `yaml:"match_type"`
 	} `yaml:"reaction"`
+	// Rules を指定した場合は reaction の代わりにこちらが使われる
+	Rules []Rule `yaml:"rules"`
+	// EmojiValidation はカスタム絵文字をインスタンスの絵文字一覧で検証する設定
+	EmojiValidation struct {
+		OnUnknown       string        `yaml:"on_unknown"`
+		FallbackEmoji   string        `yaml:"fallback_emoji"`
+		RefreshInterval time.Duration `yaml:"refresh_interval"`
+	} `yaml:"emoji_validation"`
+	// RecheckBeforeReaction はリアクション直前にnotes/showでノートを取得し直して確認するかどうか
+	RecheckBeforeReaction bool `yaml:"recheck_before_reaction"`
+	// RateLimit は全ルール合計のリアクションの頻度制限
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	// CooldownPath を指定すると投稿者ごとのクールダウンをファイルに保存し、再起動後も引き継ぐ
+	CooldownPath string `yaml:"cooldown_path"`
+	// Schedule はボット全体が動作する時間帯
+	Schedule ScheduleConfig `yaml:"schedule"`
+	// MaxNoteAge より古いノートにはリアクションしない (例: 10m)。0の場合は制限しない
+	MaxNoteAge time.Duration `yaml:"max_note_age"`
+	// Backfill は起動時や再接続時に、接続していなかった間のノートをタイムラインから取得する設定
+	Backfill BackfillConfig `yaml:"backfill"`
+	// StatePath を指定すると最後に処理したノートIDをファイルに保存し、再起動後のバックフィルに使う
+	StatePath string `yaml:"state_path"`
+	// Mode はノートの受信方法 (stream または poll)。省略時はstream
+	Mode string `yaml:"mode"`
+	// PollInterval は poll モードでタイムラインを取得する間隔。省略時は30秒
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// DryRun を有効にするとアクションを実行せず、ログに出力するだけにする
+	DryRun bool `yaml:"dry_run"`
+	// Retry はAPI呼び出しが一時的なエラーで失敗したときの再試行の設定
+	Retry RetryConfig `yaml:"retry"`
+	// Accounts を指定すると複数のアカウントやインスタンスを1つのプロセスで並行して動かす
+	Accounts []AccountConfig `yaml:"accounts"`
+	// ReconnectInterval を指定するとストリーミングが切断されたときにこの間隔で再接続する。0の場合は終了する
+	ReconnectInterval time.Duration `yaml:"reconnect_interval"`
+	// Admin はメトリクスや管理APIを提供する管理用HTTPサーバーの設定
+	Admin AdminConfig `yaml:"admin"`
+	// Audit はノートごとの判断を記録する監査ログの設定
+	Audit AuditConfig `yaml:"audit"`
+	// Record はストリーミングAPIから受信したフレームを記録する設定
+	Record RecordConfig `yaml:"record"`
+	// ConfigWatchInterval は設定ファイルの変更を確認する間隔。省略時は5秒、負の値で監視しない
+	ConfigWatchInterval time.Duration `yaml:"config_watch_interval"`
 }
 
+// BackfillConfig は取りこぼしたノートの取得の設定です。
+type BackfillConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// MaxPages は1回のバックフィルで取得する最大ページ数 (1ページ100件)。省略時は10
+	MaxPages int `yaml:"max_pages"`
+}
+
+// defaultBackfillMaxPages は backfill.max_pages の省略時の値です。
+const defaultBackfillMaxPages = 10
+
 // loadConfig reads the configuration from the specified YAML file.
 func loadConfig(configPath string) (*Config, error) {
 	file, err := os.Open(configPath)
@@ -66,56 +135,171 @@ func loadConfig(configPath string) (*Config, error) {
 	return &config, nil
 }
 
-func createReaction(misskeyURL, noteID, reaction, token string) error {
-	apiURL := misskeyURL + "/api/notes/reactions/create"
+// apiError はMisskey APIが返したエラーです。
+type apiError struct {
+	Message string
+	Code    string
+	Status  int
+}
 
-	reactionBody := reactionRequest{
-		NoteID:   noteID,
-		Reaction: reaction,
+func (e *apiError) Error() string {
+	errMsg := fmt.Sprintf("API error: %s", e.Message)
+	if e.Code != "" {
+		errMsg += fmt.Sprintf(" (Code: %s)", e.Code)
 	}
+	errMsg += fmt.Sprintf(" (Status: %d)", e.Status)
+	return errMsg
+}
+
+// apiTimeout はMisskey APIの1回の呼び出しにかける時間の上限です。
+const apiTimeout = 30 * time.Second
+
+// apiClient はMisskey APIの呼び出しで共有するHTTPクライアントです。
+// 応答しないサーバーで受信やノートの処理が止まり続けないよう、タイムアウトを設ける
+var apiClient = &http.Client{Timeout: apiTimeout}
 
-	jsonBody, err := json.Marshal(reactionBody)
+// callAPI sends body as JSON to the given Misskey API endpoint and decodes the
+// response into out when out is not nil.
+func callAPI(misskeyURL, endpoint, token string, body, out interface{}) error {
+	apiURL := misskeyURL + "/api/" + endpoint
+
+	jsonBody, err := json.Marshal(body)
 	if err != nil {
 		return fmt.Errorf("failed to marshal request body: %w", err)
 	}
 
-	req, err := http.NewRequest(http.MethodPost, apiURL, bytes.NewBuffer(jsonBody))
+	start := time.Now()
+	status, bodyBytes, err := postJSON(apiClient, apiURL, map[string]string{"Authorization": "Bearer " + token}, jsonBody)
+	apiLatency.Observe(time.Since(start).Seconds(), endpoint)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return err
+	}
+
+	if status == http.StatusNoContent {
+		return nil
+	}
+
+	if status != http.StatusOK {
+		var errorResponse misskeyErrorResponse
+		if unmarshalErr := json.Unmarshal(bodyBytes, &errorResponse); unmarshalErr != nil {
+			return fmt.Errorf("unexpected status code: %d, failed to unmarshal error response: %w, body: %s", status, unmarshalErr, string(bodyBytes))
+		}
+		return &apiError{
+			Message: errorResponse.Error.Message,
+			Code:    errorResponse.Error.Code,
+			Status:  status,
+		}
+	}
+
+	if out != nil {
+		if err := json.Unmarshal(bodyBytes, out); err != nil {
+			return fmt.Errorf("failed to unmarshal response: %w, body: %s", err, string(bodyBytes))
+		}
+	}
+	return nil
+}
+
+// postJSON posts the JSON body with the extra headers and returns the status
+// code and body of the response.
+func postJSON(client *http.Client, url string, headers map[string]string, jsonBody []byte) (int, []byte, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+token)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
 
-	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		return 0, nil, fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusNoContent {
-		// Read the response body for error details
-		bodyBytes, readErr := io.ReadAll(resp.Body)
-		if readErr != nil {
-			return fmt.Errorf("unexpected status code: %d, failed to read response body: %w", resp.StatusCode, readErr)
-		}
+	// Read the response body for the result or error details
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, nil, fmt.Errorf("unexpected status code: %d, failed to read response body: %w", resp.StatusCode, err)
+	}
+	return resp.StatusCode, bodyBytes, nil
+}
 
-		var errorResponse misskeyErrorResponse
-		if unmarshalErr := json.Unmarshal(bodyBytes, &errorResponse); unmarshalErr != nil {
-			return fmt.Errorf("unexpected status code: %d, failed to unmarshal error response: %w, body: %s", resp.StatusCode, unmarshalErr, string(bodyBytes))
-		}
+func createReaction(misskeyURL, noteID, reaction, token string) error {
+	reactionBody := reactionRequest{
+		NoteID:   noteID,
+		Reaction: reaction,
+	}
+	return callAPI(misskeyURL, "notes/reactions/create", token, reactionBody, nil)
+}
 
-		// Adjusted error message format
-		errMsg := fmt.Sprintf("API error: %s", errorResponse.Error.Message)
-		if errorResponse.Error.Code != "" {
-			errMsg += fmt.Sprintf(" (Code: %s)", errorResponse.Error.Code)
-		}
-		errMsg += fmt.Sprintf(" (Status: %d)", resp.StatusCode)
-		return fmt.Errorf(errMsg)
+// showNote fetches the note with notes/show.
+func showNote(misskeyURL, noteID, token string) (*note, error) {
+	var n note
+	if err := callAPI(misskeyURL, "notes/show", token, map[string]string{"noteId": noteID}, &n); err != nil {
+		return nil, err
 	}
+	return &n, nil
+}
 
-	return nil
+// fetchSelfID returns the user ID of the account the token belongs to.
+func fetchSelfID(misskeyURL, token string) (string, error) {
+	var user noteUser
+	if err := callAPI(misskeyURL, "i", token, struct{}{}, &user); err != nil {
+		return "", err
+	}
+	if user.ID == "" {
+		return "", errors.New("ユーザーIDを取得できませんでした")
+	}
+	return user.ID, nil
+}
+
+// isAPIError reports whether err is a Misskey API error with the given code.
+func isAPIError(err error, code string) bool {
+	var apiErr *apiError
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
+
+// note はMisskeyのノートのうち、このツールで使うフィールドです。
+type note struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	Text      string    `json:"text"`
+	UserID    string    `json:"userId"`
+	User      noteUser  `json:"user"`
+	// channel はノートを受信したチャンネル (メトリクス用)
+	channel string
+	// Visibility は公開範囲 (public, home, followers, specified)
+	Visibility string `json:"visibility,omitempty"`
+	// MyReaction は自分が付けたリアクション (未リアクションの場合は空)
+	MyReaction string `json:"myReaction,omitempty"`
+	// 他のノートのフィールドは必要に応じて追加
+}
+
+// noteUser はノートの投稿者です。
+type noteUser struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	// Host はリモートユーザーのホスト (ローカルユーザーの場合は空)
+	Host string `json:"host"`
+	Name string `json:"name"`
+}
+
+// authorID returns the user ID of the author, or "" when it is unknown.
+func (n note) authorID() string {
+	if n.User.ID != "" {
+		return n.User.ID
+	}
+	return n.UserID
+}
+
+// acct returns the user in @username or @username@host form.
+func (u noteUser) acct() string {
+	if u.Host == "" {
+		return "@" + u.Username
+	}
+	return "@" + u.Username + "@" + u.Host
 }
 
 // MisskeyストリーミングAPIのノートイベント構造体
@@ -124,118 +308,191 @@ type streamNoteEvent struct {
 	Body struct {
 		ID   string `json:"id"`
 		Type string `json:"type"`
-		Body struct {
-			ID   string `json:"id"`
-			Text string `json:"text"`
-			// 他のノートのフィールドは必要に応じて追加
-		} `json:"body"`
+		Body note   `json:"body"`
 	} `json:"body"`
 }
 
-// streamNotes connects to the Misskey streaming API and calls the callback for each note.
-func streamNotes(wsURL, token string, logger *log.Logger, noteCallback func(noteID, noteText string)) error {
+// streamNotes connects to the homeTimeline channel of the Misskey streaming
+// API and calls the callback for each note.
+func streamNotes(wsURL, token string, logger *slog.Logger, noteCallback func(n note)) error {
+	return streamChannels(wsURL, token, []string{"homeTimeline"}, logger, nil, nil, nil, noteCallback)
+}
+
+// streamChannels connects to the given channels of the Misskey streaming API
+// over one connection and calls the callback for each note. The connection
+// state is recorded in state and the received frames in rec unless they are
+// nil. Closing stop closes the connection and makes it return nil.
+func streamChannels(wsURL, token string, channels []string, logger *slog.Logger, state *connState, rec *frameRecorder, stop <-chan struct{}, noteCallback func(n note)) error {
 	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
 	if err != nil {
 		return fmt.Errorf("WebSocket接続に失敗しました: %w", err)
 	}
 	defer conn.Close()
-
-	// チャンネルに接続するためのメッセージを送信
-	connectMsg := map[string]interface{}{
-		"type": "connect",
-		"body": map[string]string{
-			"channel": "homeTimeline",
-			"id":      "main-channel-id", // 任意のID
-		},
+	state.setConnected()
+	defer state.setDisconnected()
+
+	// stop が閉じられたら接続を閉じ、読み込みを終わらせる
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stop:
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	channelIDs := subscriptionIDs(channels)
+	for i, channel := range channels {
+		// チャンネルに接続するためのメッセージを送信
+		connectMsg := map[string]interface{}{
+			"type": "connect",
+			"body": map[string]string{
+				"channel": channel,
+				"id":      subscriptionID(i),
+				"i":       token,
+			},
+		}
+		if err := conn.WriteJSON(connectMsg); err != nil {
+			if stopped(stop) {
+				return nil
+			}
+			return fmt.Errorf("WebSocketメッセージの送信に失敗しました: %w", err)
+		}
 	}
-
-	// トークンをメッセージに追加
-	connectMsgBody := connectMsg["body"].(map[string]string)
-	connectMsgBody["i"] = token
-
-	if err := conn.WriteJSON(connectMsg); err != nil {
-		return fmt.Errorf("WebSocketメッセージの送信に失敗しました: %w", err)
+	state.setSubscribed(time.Now())
+	if err := rec.subscribed(channels); err != nil {
+		logger.Warn("受信したフレームの記録に失敗しました", errorAttrs(err)...)
 	}
 
 	for {
 		_, message, err := conn.ReadMessage()
 		if err != nil {
+			if stopped(stop) {
+				return nil
+			}
 			return fmt.Errorf("WebSocketメッセージの読み込みに失敗しました: %w", err)
 		}
-
-		var event streamNoteEvent
-		if err := json.Unmarshal(message, &event); err != nil {
-			// エラーをログに出力するが、処理は続行
-			logger.Printf("エラー: WebSocketメッセージのパースに失敗しました: %v, メッセージ: %s\n", err, string(message))
-			continue
-		}
-
-		if event.Type == "channel" && event.Body.Type == "note" {
-			noteCallback(event.Body.Body.ID, event.Body.Body.Text)
+		state.setReceived(time.Now())
+		if err := rec.frame(message); err != nil {
+			logger.Warn("受信したフレームの記録に失敗しました", errorAttrs(err)...)
 		}
+		handleStreamMessage(message, channelIDs, logger, noteCallback)
 	}
 }
 
-func checkTextMatch(noteText string, config *Config) bool {
-	switch config.Reaction.MatchType {
-	case "prefix":
-		return strings.HasPrefix(noteText, config.Reaction.MatchText)
-	case "suffix":
-		return strings.HasSuffix(noteText, config.Reaction.MatchText)
-	case "contains", "": // デフォルトは部分一致
-		return strings.Contains(noteText, config.Reaction.MatchText)
-	default:
-		return false
-	}
+// subscriptionID returns the ID used to subscribe to the i-th channel.
+func subscriptionID(i int) string {
+	return fmt.Sprintf("channel-%d", i) // 任意のID
 }
 
-func runApp(config *Config, logger *log.Logger) error {
-	// 設定値のバリデーション
-	if config.Misskey.URL == "" {
-		return fmt.Errorf("エラー: 設定ファイルにMisskeyのURLが指定されていません")
-	}
-	if config.Misskey.Token == "" {
-		return fmt.Errorf("エラー: 設定ファイルにMisskeyのAPIトークンが指定されていません")
+// subscriptionIDs maps the subscription IDs to the channels.
+func subscriptionIDs(channels []string) map[string]string {
+	ids := make(map[string]string, len(channels))
+	for i, channel := range channels {
+		ids[subscriptionID(i)] = channel
 	}
-	if config.Reaction.MatchText == "" {
-		return fmt.Errorf("エラー: 設定ファイルにリアクション対象の文字列(match_text)が指定されていません")
+	return ids
+}
+
+// handleStreamMessage parses a message of the streaming API and calls the
+// callback when it carries a note of a subscribed channel.
+func handleStreamMessage(message []byte, channelIDs map[string]string, logger *slog.Logger, noteCallback func(n note)) {
+	var event streamNoteEvent
+	if err := json.Unmarshal(message, &event); err != nil {
+		// エラーをログに出力するが、処理は続行
+		logger.Error("WebSocketメッセージのパースに失敗しました", logKeyError, err.Error(), "message", string(message))
+		return
 	}
 
-	// リアクションが指定されていない場合はデフォルト値を使用
-	if config.Reaction.Emoji == "" {
-		config.Reaction.Emoji = "👍"
+	if event.Type == "channel" && event.Body.Type == "note" {
+		n := event.Body.Body
+		n.channel = channelIDs[event.Body.ID]
+		noteCallback(n)
 	}
+}
 
-	// ストリーミングAPIのURLを構築
-	wsURL := strings.Replace(config.Misskey.URL, "http", "ws", 1) + "/streaming?i=" + config.Misskey.Token
+// stopped reports whether the stop channel has been closed.
+func stopped(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
 
-	logger.Printf("MisskeyストリーミングAPIに接続中... %s\n", wsURL)
+// runApp runs the accounts of the config. The config cannot be reloaded
+// because its file is unknown.
+func runApp(config *Config, logger *slog.Logger) error {
+	a, err := newApp("", config, logger)
+	if err != nil {
+		return err
+	}
+	return a.run()
+}
 
-	// ストリーミングAPIからノートを受信し、リアクションを投稿
-	err := streamNotes(wsURL, config.Misskey.Token, logger, func(noteID, noteText string) {
-		// 特定文字列に合致するかチェック
-		if !checkTextMatch(noteText, config) {
-			return // 合致しない場合はスキップ
+// noteReceiver returns a function that receives notes with the configured
+// mode and calls the callback for each note until an error occurs or stop is
+// closed. In stream mode, the received frames are recorded in rec unless it is
+// nil.
+func noteReceiver(config *Config, logger *slog.Logger, state *connState, rec *frameRecorder) (receiveFunc, error) {
+	switch config.Mode {
+	case "", modeStream:
+		// ストリーミングAPIのURLを構築
+		wsURL := strings.Replace(config.Misskey.URL, "http", "ws", 1) + "/streaming?i=" + config.Misskey.Token
+		return func(stop <-chan struct{}, noteCallback func(n note)) error {
+			logger.Info("MisskeyストリーミングAPIに接続中...", "url", config.Misskey.URL, "channels", config.Misskey.channels())
+			if err := streamChannels(wsURL, config.Misskey.Token, config.Misskey.channels(), logger, state, rec, stop, noteCallback); err != nil {
+				return fmt.Errorf("ストリーミングAPIの処理中にエラーが発生しました: %w", err)
+			}
+			return nil
+		}, nil
+	case modePoll:
+		channels := config.Misskey.channels()
+		if len(channels) > 1 {
+			return nil, fmt.Errorf("エラー: pollモードではチャンネルを1つだけ指定できます")
 		}
-
-		// 即時リアクションが来るのは怖いので若干遅延させる
-		delay := time.Duration(rand.Intn(4)+5) * time.Second
-		time.Sleep(delay)
-
-		logger.Printf("ノートID: %s, テキスト: %s にリアクション %s を投稿します\n", noteID, noteText, config.Reaction.Emoji)
-		if err := createReaction(config.Misskey.URL, noteID, config.Reaction.Emoji, config.Misskey.Token); err != nil {
-			logger.Printf("エラー: リアクションの投稿に失敗しました: %v\n", err)
+		endpoint, err := timelineEndpoint(channels[0])
+		if err != nil {
+			return nil, fmt.Errorf("エラー: %w", err)
 		}
-	})
-
-	if err != nil {
-		return fmt.Errorf("ストリーミングAPIの処理中にエラーが発生しました: %w", err)
+		interval := config.PollInterval
+		if interval <= 0 {
+			interval = defaultPollInterval
+		}
+		return func(stop <-chan struct{}, noteCallback func(n note)) error {
+			logger.Info("Misskeyのタイムラインをポーリング中...", "url", config.Misskey.URL, "endpoint", endpoint, "interval", interval.String())
+			receive := func(n note) {
+				n.channel = channels[0]
+				noteCallback(n)
+			}
+			if err := pollNotes(config.Misskey.URL, endpoint, config.Misskey.Token, "", interval, state, stop, receive); err != nil {
+				return fmt.Errorf("タイムラインのポーリング中にエラーが発生しました: %w", err)
+			}
+			return nil
+		}, nil
+	default:
+		return nil, fmt.Errorf("エラー: mode %q は不正です (stream または poll を指定してください)", config.Mode)
 	}
-
-	return nil
 }
 
 func run(args []string, stdout, stderr io.Writer) error {
+	// サブコマンド
+	if len(args) > 1 && !strings.HasPrefix(args[1], "-") {
+		switch args[1] {
+		case "schedule":
+			return runSchedule(args[1:], stdout, stderr)
+		case "ctl":
+			return runCtl(args[1:], stdout, stderr)
+		case "replay":
+			return runReplay(args[1:], stdout, stderr)
+		default:
+			fmt.Fprintf(stderr, "不明なサブコマンドです: %s\n", args[1])
+			return fmt.Errorf("不明なサブコマンドです: %s", args[1])
+		}
+	}
+
 	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
 	fs.SetOutput(stderr)
 	configPath := fs.String("config", "config.yaml", "設定ファイルのパス")
@@ -253,8 +510,9 @@ func run(args []string, stdout, stderr io.Writer) error {
 
 	// ログ出力先を設定
 	var logWriter io.Writer = stdout
+	var logFile *logrotate.Writer
 	if config.LogPath != "" {
-		logFile, err := os.OpenFile(config.LogPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+		logFile, err = logrotate.Open(config.LogPath, config.LogRotate)
 		if err != nil {
 			// ログファイルが開けないエラーはstderrに
 			fmt.Fprintf(stderr, "ログファイルを開けませんでした: %v\n", err)
@@ -264,16 +522,57 @@ func run(args []string, stdout, stderr io.Writer) error {
 		logWriter = logFile
 	}
 
-	logger := log.New(logWriter, "", log.Ldate|log.Ltime)
+	logger, err := newLogger(logWriter, config.LogFormat, config.LogLevel)
+	if err != nil {
+		fmt.Fprintf(stderr, "エラー: %v\n", err)
+		return err
+	}
 
-	if err := runApp(config, logger); err != nil {
-		logger.Println(err)
+	a, err := newApp(*configPath, config, logger)
+	if err == nil {
+		stop := handleSIGHUP(logFile, a, logger)
+		err = a.run()
+		stop()
+	}
+	if err != nil {
+		logger.Error(err.Error())
 		return err
 	}
 
 	return nil
 }
 
+// handleSIGHUP reopens the log file unless it is nil, so that external tools
+// such as logrotate can move the file, and reloads the config whenever the
+// process receives SIGHUP. It returns a function that stops the handling.
+func handleSIGHUP(logFile *logrotate.Writer, a *app, logger *slog.Logger) func() {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-sighup:
+				if logFile != nil {
+					if err := logFile.Reopen(); err != nil {
+						fmt.Fprintf(os.Stderr, "ログファイルを開き直せませんでした: %v\n", err)
+					} else {
+						logger.Info("SIGHUPを受信したため、ログファイルを開き直しました")
+					}
+				}
+				logger.Info("SIGHUPを受信したため、設定ファイルを再読み込みします")
+				a.tryReload()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sighup)
+		close(done)
+	}
+}
+
 func main() {
 	if err := run(os.Args, os.Stdout, os.Stderr); err != nil {
 		// runApp内でエラーはすでに出力されているはずなので、ここでは終了するだけ
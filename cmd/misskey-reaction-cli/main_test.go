@@ -3,14 +3,20 @@ package main
 import (
 	"bytes"
 	"encoding/json"
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/gorilla/websocket"
+
+	"misskey-reaction-cli/internal/logrotate"
 )
 
 func TestCreateReaction_Success(t *testing.T) {
@@ -67,6 +73,28 @@ func TestCreateReaction_APIError(t *testing.T) {
 	}
 }
 
+func TestCallAPI_Timeout(t *testing.T) {
+	// テストが終わるまで応答を返さないMisskey APIのモックサーバー
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+	defer func(client *http.Client) { apiClient = client }(apiClient)
+	apiClient = &http.Client{Timeout: 100 * time.Millisecond}
+
+	start := time.Now()
+	_, err := showNote(server.URL, "note1", "testToken")
+
+	if err == nil || !strings.Contains(err.Error(), "Client.Timeout exceeded") {
+		t.Errorf("タイムアウトのエラーを期待しましたが、実際: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("タイムアウトで打ち切られていません: %v", elapsed)
+	}
+}
+
 func TestStreamNotes(t *testing.T) {
 	// モックWebSocketサーバーをセットアップ
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -77,26 +105,12 @@ func TestStreamNotes(t *testing.T) {
 		defer conn.Close()
 
 		// テスト用のノートイベントを送信
-		noteEvent := streamNoteEvent{
-			Type: "channel",
-			Body: struct {
-				ID   string `json:"id"`
-				Type string `json:"type"`
-				Body struct {
-					ID   string `json:"id"`	
-					Text string `json:"text"`
-				} `json:"body"`
-			}{
-				ID:   "testChannelId",
-				Type: "note",
-				Body: struct {
-					ID   string `json:"id"`
-					Text string `json:"text"`
-				}{
-					ID:   "testNoteId123",
-					Text: "これはテストノートです",
-				},
-			},
+		noteEvent := streamNoteEvent{Type: "channel"}
+		noteEvent.Body.ID = "testChannelId"
+		noteEvent.Body.Type = "note"
+		noteEvent.Body.Body = note{
+			ID:   "testNoteId123",
+			Text: "これはテストノートです",
 		}
 		jsonBytes, _ := json.Marshal(noteEvent)
 		conn.WriteMessage(websocket.TextMessage, jsonBytes)
@@ -110,9 +124,9 @@ func TestStreamNotes(t *testing.T) {
 	wsURL := "ws" + server.URL[len("http"):]
 
 	var logBuffer bytes.Buffer
-	logger := log.New(&logBuffer, "", log.Ldate|log.Ltime)
+	logger := slog.New(slog.NewTextHandler(&logBuffer, nil))
 	// テスト対象の関数を呼び出す
-	streamNotes(wsURL, "testToken", logger, func(noteID, noteText string) {
+	streamNotes(wsURL, "testToken", logger, func(n note) {
 		// This is a dummy callback for testing compilation
 	})
 }
@@ -138,15 +152,15 @@ func TestStreamNotes_ParseError(t *testing.T) {
 	wsURL := "ws" + server.URL[len("http"):]
 
 	var logBuffer bytes.Buffer
-	logger := log.New(&logBuffer, "", log.Ldate|log.Ltime)
+	logger := slog.New(slog.NewTextHandler(&logBuffer, nil))
 	// テスト対象の関数を呼び出す
-	streamNotes(wsURL, "testToken", logger, func(noteID, noteText string) {
+	streamNotes(wsURL, "testToken", logger, func(n note) {
 		// コールバックは呼び出されないはず
 		t.Error("コールバックが呼び出されましたが、これはエラーケースです")
 	})
 
 	// ログにエラーメッセージが含まれていることを確認
-	expectedLog := "エラー: WebSocketメッセージのパースに失敗しました"
+	expectedLog := "level=ERROR msg=WebSocketメッセージのパースに失敗しました"
 	if !strings.Contains(logBuffer.String(), expectedLog) {
 		t.Errorf("ログに期待するエラー '%s' が含まれていませんでした: %s", expectedLog, logBuffer.String())
 	}
@@ -195,10 +209,7 @@ reaction:
 
 func TestRunApp_MissingMatchText(t *testing.T) {
 	config := &Config{
-		Misskey: struct {
-			URL   string `yaml:"url"`
-			Token string `yaml:"token"`
-		}{
+		Misskey: MisskeyConfig{
 			URL:   "https://test.misskey.example.com",
 			Token: "test_token_123",
 		},
@@ -212,7 +223,7 @@ func TestRunApp_MissingMatchText(t *testing.T) {
 	}
 
 	var logBuffer bytes.Buffer
-	logger := log.New(&logBuffer, "", log.Ldate|log.Ltime)
+	logger := slog.New(slog.NewTextHandler(&logBuffer, nil))
 	err := runApp(config, logger)
 
 	if err == nil {
@@ -226,44 +237,6 @@ func TestRunApp_MissingMatchText(t *testing.T) {
 	}
 }
 
-func TestCheckTextMatch(t *testing.T) {
-	tests := []struct {
-		name      string
-		matchType string
-		noteText  string
-		matchText string
-		expected  bool
-	}{
-		{"前方一致_一致", "prefix", "hello world", "hello", true},
-		{"前方一致_不一致", "prefix", "hello world", "world", false},
-		{"後方一致_一致", "suffix", "hello world", "world", true},
-		{"後方一致_不一致", "suffix", "hello world", "hello", false},
-		{"部分一致_一致", "contains", "hello world", "lo wo", true},
-		{"部分一致_不一致", "contains", "hello world", "wollo", false},
-		{"デフォルト(部分一致)_一致", "", "hello world", "lo wo", true},
-		{"デフォルト(部分一致)_不一致", "", "hello world", "wollo", false},
-		{"無効なタイプ", "invalid", "hello world", "hello", false},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			config := &Config{
-				Reaction: struct {
-					Emoji     string `yaml:"emoji"`
-					MatchText string `yaml:"match_text"`
-					MatchType string `yaml:"match_type"`
-				}{
-					MatchText: tt.matchText,
-					MatchType: tt.matchType,
-				},
-			}
-			if checkTextMatch(tt.noteText, config) != tt.expected {
-				t.Errorf("期待値: %v, 実際: %v", tt.expected, !tt.expected)
-			}
-		})
-	}
-}
-
 func TestLoadConfig_InvalidYaml(t *testing.T) {
 	// 無効なYAMLコンテンツ
 	configContent := `
@@ -303,10 +276,7 @@ reaction:
 
 func TestRunApp_MissingURL(t *testing.T) {
 	config := &Config{
-		Misskey: struct {
-			URL   string `yaml:"url"`
-			Token string `yaml:"token"`
-		}{
+		Misskey: MisskeyConfig{
 			URL:   "", // URL is missing
 			Token: "test_token_123",
 		},
@@ -320,7 +290,7 @@ func TestRunApp_MissingURL(t *testing.T) {
 	}
 
 	var logBuffer bytes.Buffer
-	logger := log.New(&logBuffer, "", log.Ldate|log.Ltime)
+	logger := slog.New(slog.NewTextHandler(&logBuffer, nil))
 	err := runApp(config, logger)
 
 	if err == nil {
@@ -334,10 +304,7 @@ func TestRunApp_MissingURL(t *testing.T) {
 
 func TestRunApp_MissingToken(t *testing.T) {
 	config := &Config{
-		Misskey: struct {
-			URL   string `yaml:"url"`
-			Token string `yaml:"token"`
-		}{
+		Misskey: MisskeyConfig{
 			URL:   "https://test.misskey.example.com",
 			Token: "", // Token is missing
 		},
@@ -351,7 +318,7 @@ func TestRunApp_MissingToken(t *testing.T) {
 	}
 
 	var logBuffer bytes.Buffer
-	logger := log.New(&logBuffer, "", log.Ldate|log.Ltime)
+	logger := slog.New(slog.NewTextHandler(&logBuffer, nil))
 	err := runApp(config, logger)
 
 	if err == nil {
@@ -377,8 +344,8 @@ func TestCreateReaction_RequestCreationError(t *testing.T) {
 func TestStreamNotes_DialError(t *testing.T) {
 	// 存在しないサーバーへの接続を試みる
 	var logBuffer bytes.Buffer
-	logger := log.New(&logBuffer, "", log.Ldate|log.Ltime)
-	err := streamNotes("ws://localhost:9999", "token", logger, func(noteID, noteText string) {
+	logger := slog.New(slog.NewTextHandler(&logBuffer, nil))
+	err := streamNotes("ws://localhost:9999", "token", logger, func(n note) {
 		t.Error("コールバックが呼び出されるべきではありません")
 	})
 	if err == nil {
@@ -448,4 +415,64 @@ reaction:
 	if !strings.Contains(stderr.String(), expectedError) {
 		t.Errorf("期待するエラー '%s' が含まれていませんでした: %s", expectedError, stderr.String())
 	}
-}
\ No newline at end of file
+}
+
+func TestRunApp_InvalidMode(t *testing.T) {
+	config := &Config{
+		Misskey: MisskeyConfig{URL: "http://localhost", Token: "test_token_123"},
+		Rules:   []Rule{{MatchText: "hello"}},
+		Mode:    "push",
+	}
+	config.EmojiValidation.OnUnknown = emojiValidationOff
+
+	var logBuffer bytes.Buffer
+	err := runApp(config, slog.New(slog.NewTextHandler(&logBuffer, nil)))
+
+	expectedError := `mode "push" は不正です`
+	if err == nil || !strings.Contains(err.Error(), expectedError) {
+		t.Errorf("期待するエラーメッセージ: '%s', 実際: %v", expectedError, err)
+	}
+}
+
+func TestHandleSIGHUP(t *testing.T) {
+	server := newMockMisskey(t, `{"emojis":[]}`)
+	a, configPath, _ := newTestApp(t, fmt.Sprintf(testAppConfig, server.URL, "greet", "hello"))
+	old := a.accounts[0].currentBot()
+
+	path := filepath.Join(t.TempDir(), "app.log")
+	logFile, err := logrotate.Open(path, logrotate.Options{})
+	if err != nil {
+		t.Fatalf("ログファイルを開けませんでした: %v", err)
+	}
+	defer logFile.Close()
+	logger := slog.New(slog.NewTextHandler(logFile, nil))
+	a.logger = logger
+	stop := handleSIGHUP(logFile, a, logger)
+	defer stop()
+	os.WriteFile(configPath, []byte(fmt.Sprintf(testAppConfig, server.URL, "greet", "bye")), 0644)
+
+	// 外部のlogrotateがファイルを移動してからSIGHUPを送る
+	logger.Info("移動前")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	syscall.Kill(os.Getpid(), syscall.SIGHUP)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		data, _ := os.ReadFile(path)
+		if strings.Contains(string(data), "ログファイルを開き直しました") && strings.Contains(string(data), "設定ファイルを再読み込みしました") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("新しいログファイルに開き直しと再読み込みのログが書き込まれませんでした: %q", data)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if data, _ := os.ReadFile(path + ".1"); !strings.Contains(string(data), "移動前") {
+		t.Errorf("移動したファイルに元のログが残っていることを期待しました: %q", data)
+	}
+	if b := a.accounts[0].currentBot(); b == old || b.rules[0].MatchText != "bye" {
+		t.Error("SIGHUPで設定ファイルを再読み込みすることを期待しました")
+	}
+}
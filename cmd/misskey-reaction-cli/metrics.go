@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"misskey-reaction-cli/internal/metrics"
+)
+
+// metricsRegistry はプロセス全体のメトリクスです。複数のアカウントはaccountラベルで区別する
+var metricsRegistry = metrics.NewRegistry()
+
+var (
+	notesReceived = metricsRegistry.NewCounter("misskey_reaction_notes_received_total",
+		"受信したノートの数 (重複を含む)", "account", "channel")
+	ruleMatches = metricsRegistry.NewCounter("misskey_reaction_rule_matches_total",
+		"ルールに一致したノートの数", "account", "rule")
+	reactionsSent = metricsRegistry.NewCounter("misskey_reaction_reactions_sent_total",
+		"投稿したリアクションの数", "account", "rule")
+	reactionsFailed = metricsRegistry.NewCounter("misskey_reaction_reactions_failed_total",
+		"失敗したリアクションの数", "account", "error_code")
+	queueDepth = metricsRegistry.NewGauge("misskey_reaction_queue_depth",
+		"受信して処理を待っているノートの数", "account")
+	apiLatency = metricsRegistry.NewHistogram("misskey_reaction_api_request_duration_seconds",
+		"Misskey APIの呼び出しにかかった時間 (秒)", metrics.DefaultBuckets, "endpoint")
+	reconnects = metricsRegistry.NewCounter("misskey_reaction_reconnects_total",
+		"切断後に再接続した回数", "account")
+	lastMessage = metricsRegistry.NewGauge("misskey_reaction_last_message_timestamp_seconds",
+		"ストリーミングAPIのメッセージまたはポーリングの結果を最後に受信した時刻 (UNIX時間)", "account")
+)
+
+// errorCode returns the label for a failed API call: the Misskey error code,
+// HTTP_<status> for an API error without a code, or NETWORK_ERROR.
+func errorCode(err error) string {
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) {
+		return "NETWORK_ERROR"
+	}
+	if apiErr.Code != "" {
+		return apiErr.Code
+	}
+	return fmt.Sprintf("HTTP_%d", apiErr.Status)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"APIのエラーコード", &apiError{Code: "RATE_LIMIT_EXCEEDED", Status: 429}, "RATE_LIMIT_EXCEEDED"},
+		{"コードのないAPIエラー", &apiError{Status: 502}, "HTTP_502"},
+		{"通信エラー", errors.New("connection refused"), "NETWORK_ERROR"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorCode(tt.err); got != tt.expected {
+				t.Errorf("期待値: %s, 実際: %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestBotHandleNote_Metrics(t *testing.T) {
+	server := newMockMisskey(t, `{"emojis":[]}`)
+	b, _ := newTestBot(t, testConfig(server.URL, Rule{Name: "greet", MatchText: "hello"}))
+	b.account = "metrics-test"
+
+	b.handleNote(note{ID: "note1", Text: "hello", channel: "homeTimeline"})
+	b.handleNote(note{ID: "note1", Text: "hello", channel: "localTimeline"}) // 重複も受信数に含める
+	b.handleNote(note{ID: "note2", Text: "bye", channel: "homeTimeline"})
+	server.reactionErrorCode = "ALREADY_REACTED"
+	b.handleNote(note{ID: "note3", Text: "hello", channel: "homeTimeline"})
+
+	for _, tt := range []struct {
+		name     string
+		got      float64
+		expected float64
+	}{
+		{"homeTimelineの受信数", notesReceived.Value("metrics-test", "homeTimeline"), 3},
+		{"localTimelineの受信数", notesReceived.Value("metrics-test", "localTimeline"), 1},
+		{"ルールの一致数", ruleMatches.Value("metrics-test", "greet"), 2},
+		{"リアクションの投稿数", reactionsSent.Value("metrics-test", "greet"), 1},
+		{"リアクションの失敗数", reactionsFailed.Value("metrics-test", "ALREADY_REACTED"), 1},
+	} {
+		if tt.got != tt.expected {
+			t.Errorf("%s 期待値: %v, 実際: %v", tt.name, tt.expected, tt.got)
+		}
+	}
+	// 処理したノートではなく、受信したメッセージの時刻を記録する
+	if lastMessage.Value("metrics-test") != 0 {
+		t.Error("ノートの処理では受信した時刻を記録しないことを期待しました")
+	}
+	(&connState{account: "metrics-test"}).setReceived(time.Unix(1700000000, 0))
+	if lastMessage.Value("metrics-test") != 1700000000 {
+		t.Errorf("受信した時刻を期待しましたが、実際: %v", lastMessage.Value("metrics-test"))
+	}
+	if apiLatency.Count("notes/reactions/create") == 0 {
+		t.Error("API呼び出しの所要時間が記録されていませんでした")
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import "sync"
+
+// pauseState はbot全体と個々のルールの一時停止の状態です。
+// 設定を再読み込みしても引き継ぐため、botではなくアカウントが持つ
+type pauseState struct {
+	mu    sync.Mutex
+	all   bool
+	rules map[string]bool
+}
+
+func newPauseState() *pauseState {
+	return &pauseState{rules: make(map[string]bool)}
+}
+
+// set pauses or resumes the rule, or the whole bot when rule is empty.
+func (p *pauseState) set(rule string, paused bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch {
+	case rule == "":
+		p.all = paused
+	case paused:
+		p.rules[rule] = true
+	default:
+		delete(p.rules, rule)
+	}
+}
+
+// isPaused reports whether the rule must not run, because either the rule
+// or the whole bot is paused. A nil state is never paused.
+func (p *pauseState) isPaused(rule string) bool {
+	if p == nil {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.all || p.rules[rule]
+}
+
+// allPaused reports whether the whole bot is paused.
+func (p *pauseState) allPaused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.all
+}
@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestPauseState(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(p *pauseState)
+		greet    bool
+		other    bool
+		allPause bool
+	}{
+		{"初期状態", func(p *pauseState) {}, false, false, false},
+		{"ルールを一時停止", func(p *pauseState) { p.set("greet", true) }, true, false, false},
+		{"ルールを再開", func(p *pauseState) { p.set("greet", true); p.set("greet", false) }, false, false, false},
+		{"全体を一時停止", func(p *pauseState) { p.set("", true) }, true, true, true},
+		{"全体を再開してもルールの一時停止は残る", func(p *pauseState) {
+			p.set("greet", true)
+			p.set("", true)
+			p.set("", false)
+		}, true, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPauseState()
+			tt.setup(p)
+			if p.isPaused("greet") != tt.greet || p.isPaused("other") != tt.other || p.allPaused() != tt.allPause {
+				t.Errorf("期待値: (%v, %v, %v), 実際: (%v, %v, %v)", tt.greet, tt.other, tt.allPause, p.isPaused("greet"), p.isPaused("other"), p.allPaused())
+			}
+		})
+	}
+
+	var nilState *pauseState
+	if nilState.isPaused("greet") {
+		t.Error("nilの状態は一時停止しないことを期待しました")
+	}
+}
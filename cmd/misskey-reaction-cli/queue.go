@@ -0,0 +1,93 @@
+package main
+
+import "sync"
+
+// noteQueueCapacity は処理を待つノートの上限です。満杯の間は受信を待たせる
+const noteQueueCapacity = 1000
+
+// noteQueue は受信したノートを処理するまで保持するFIFOです。
+// 受信と処理を分けることで、リアクションまでの待ち時間の間もWebSocketを読み続けられる
+type noteQueue struct {
+	capacity int
+	// onChange はノートの数が変わるたびに呼ばれる (nilなら呼ばない)
+	onChange func(depth int)
+
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	items    []note
+	closed   bool
+}
+
+// newNoteQueue creates an empty queue holding up to capacity notes.
+func newNoteQueue(capacity int, onChange func(depth int)) *noteQueue {
+	q := &noteQueue{capacity: capacity, onChange: onChange}
+	q.notEmpty = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+	return q
+}
+
+// push appends the note, waiting while the queue is full. Notes pushed
+// after close are dropped.
+func (q *noteQueue) push(n note) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.items) >= q.capacity && !q.closed {
+		q.notFull.Wait()
+	}
+	if q.closed {
+		return
+	}
+	q.items = append(q.items, n)
+	q.changed()
+	q.notEmpty.Signal()
+}
+
+// pop removes the oldest note, waiting while the queue is empty. It returns
+// false once the queue is closed and drained.
+func (q *noteQueue) pop() (note, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.items) == 0 && !q.closed {
+		q.notEmpty.Wait()
+	}
+	if len(q.items) == 0 {
+		return note{}, false
+	}
+	n := q.items[0]
+	q.items[0] = note{}
+	q.items = q.items[1:]
+	q.changed()
+	q.notFull.Signal()
+	return n, true
+}
+
+// close stops accepting notes. The notes already queued can still be popped.
+func (q *noteQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+}
+
+// len returns the number of queued notes.
+func (q *noteQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// pending returns a copy of the queued notes, oldest first.
+func (q *noteQueue) pending() []note {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]note(nil), q.items...)
+}
+
+// changed reports the new depth. The caller must hold mu.
+func (q *noteQueue) changed() {
+	if q.onChange != nil {
+		q.onChange(len(q.items))
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNoteQueue(t *testing.T) {
+	var depths []int
+	q := newNoteQueue(2, func(depth int) { depths = append(depths, depth) })
+
+	q.push(note{ID: "note1"})
+	q.push(note{ID: "note2"})
+
+	// 満杯の間は追加を待つ
+	pushed := make(chan struct{})
+	go func() {
+		q.push(note{ID: "note3"})
+		close(pushed)
+	}()
+	select {
+	case <-pushed:
+		t.Fatal("満杯のキューへの追加は待つことを期待しました")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	var got []string
+	n, _ := q.pop()
+	got = append(got, n.ID)
+	<-pushed
+	q.close()
+	q.push(note{ID: "note4"}) // 閉じた後の追加は捨てる
+	for {
+		n, ok := q.pop()
+		if !ok {
+			break
+		}
+		got = append(got, n.ID)
+	}
+
+	if expected := []string{"note1", "note2", "note3"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("期待値: %v, 実際: %v", expected, got)
+	}
+	if expected := []int{1, 2, 1, 2, 1, 0}; !reflect.DeepEqual(depths, expected) {
+		t.Errorf("キューの長さの変化 期待値: %v, 実際: %v", expected, depths)
+	}
+}
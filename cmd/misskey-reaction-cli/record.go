@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"misskey-reaction-cli/internal/logrotate"
+)
+
+// RecordConfig はストリーミングAPIから受信したフレームを記録する設定です。
+type RecordConfig struct {
+	// Path を指定すると、受信したフレームを時刻付きでJSON Lines形式で追記する (replayで再生できる)
+	Path string `yaml:"path"`
+	// Rotate はpathのローテートの設定
+	Rotate logrotate.Options `yaml:"rotate"`
+}
+
+// recordedFrame は記録ファイルの1行です。接続ごとに購読したチャンネルの行があり、
+// その後に受信したフレームの行が続く
+type recordedFrame struct {
+	Time    time.Time `json:"time"`
+	Account string    `json:"account,omitempty"`
+	// Channels は接続時に購読したチャンネル
+	Channels []string `json:"channels,omitempty"`
+	// UserID は接続時に確かめた自分のユーザーID (再生で自分のノートを除外するのに使う)
+	UserID string `json:"user_id,omitempty"`
+	// Data は受信したフレームそのもの
+	Data string `json:"data,omitempty"`
+}
+
+// frameRecorder appends the frames received from the streaming API to a
+// file. A nil *frameRecorder records nothing.
+type frameRecorder struct {
+	mu      *sync.Mutex
+	w       io.Writer
+	account string
+	now     func() time.Time
+}
+
+// newFrameRecorder returns a recorder that writes to w.
+func newFrameRecorder(w io.Writer) *frameRecorder {
+	return &frameRecorder{mu: &sync.Mutex{}, w: w, now: time.Now}
+}
+
+// forAccount returns a recorder that writes to the same file and marks each
+// line with the account name.
+func (r *frameRecorder) forAccount(name string) *frameRecorder {
+	if r == nil {
+		return nil
+	}
+	copied := *r
+	copied.account = name
+	return &copied
+}
+
+// subscribed records the channels subscribed on a new connection.
+func (r *frameRecorder) subscribed(channels []string) error {
+	if r == nil {
+		return nil
+	}
+	return r.write(recordedFrame{Channels: channels})
+}
+
+// self records the user ID of the account, checked before connecting.
+func (r *frameRecorder) self(userID string) error {
+	if r == nil {
+		return nil
+	}
+	return r.write(recordedFrame{UserID: userID})
+}
+
+// frame records a received frame.
+func (r *frameRecorder) frame(data []byte) error {
+	if r == nil {
+		return nil
+	}
+	return r.write(recordedFrame{Data: string(data)})
+}
+
+func (r *frameRecorder) write(f recordedFrame) error {
+	f.Time = r.now()
+	f.Account = r.account
+	line, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err = r.w.Write(append(line, '\n'))
+	return err
+}
+
+// readRecording calls fn for each line of a recording, in order, until fn
+// returns an error.
+func readRecording(r io.Reader, fn func(f recordedFrame) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var f recordedFrame
+		if err := json.Unmarshal(scanner.Bytes(), &f); err != nil {
+			return fmt.Errorf("記録ファイルの %d 行目を読み込めません: %w", line, err)
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("記録ファイルの読み込みに失敗しました: %w", err)
+	}
+	return nil
+}
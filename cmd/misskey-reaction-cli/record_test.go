@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFrameRecorder(t *testing.T) {
+	var buf bytes.Buffer
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	rec := newFrameRecorder(&buf)
+	rec.now = func() time.Time { return now }
+
+	rec.self("user1")
+	rec.subscribed([]string{"homeTimeline"})
+	rec.forAccount("main").frame([]byte(`{"type":"channel"}`))
+	var nilRecorder *frameRecorder
+	if err := nilRecorder.forAccount("main").frame([]byte("ignored")); err != nil {
+		t.Errorf("nilのレコーダーは何もしないことを期待しましたが、実際: %v", err)
+	}
+
+	var got []recordedFrame
+	err := readRecording(&buf, func(f recordedFrame) error {
+		got = append(got, f)
+		return nil
+	})
+	expected := []recordedFrame{
+		{Time: now, UserID: "user1"},
+		{Time: now, Channels: []string{"homeTimeline"}},
+		{Time: now, Account: "main", Data: `{"type":"channel"}`},
+	}
+	if err != nil || !reflect.DeepEqual(got, expected) {
+		t.Errorf("期待値: %+v, 実際: %+v, %v", expected, got, err)
+	}
+}
+
+func TestReadRecording_Invalid(t *testing.T) {
+	err := readRecording(strings.NewReader("{}\nbroken\n"), func(recordedFrame) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "記録ファイルの 2 行目を読み込めません") {
+		t.Errorf("2行目のエラーを期待しましたが、実際: %v", err)
+	}
+}
+
+func TestStreamChannels_Record(t *testing.T) {
+	server := newMockMisskey(t, `{"emojis":[]}`)
+	server.stream = []note{{ID: "note1", Text: "hello"}, {ID: "note2", Text: "bye"}}
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/streaming"
+	var buf bytes.Buffer
+
+	streamChannels(wsURL, "testToken", []string{"localTimeline"}, slog.New(slog.NewTextHandler(io.Discard, nil)), nil, newFrameRecorder(&buf), nil, func(n note) {})
+
+	var lines []recordedFrame
+	readRecording(&buf, func(f recordedFrame) error {
+		lines = append(lines, f)
+		return nil
+	})
+	if len(lines) != 3 || !reflect.DeepEqual(lines[0].Channels, []string{"localTimeline"}) {
+		t.Fatalf("チャンネルの行と2つのフレームを期待しましたが、実際: %+v", lines)
+	}
+	if !strings.Contains(lines[1].Data, `"id":"note1"`) || !strings.Contains(lines[2].Data, `"id":"note2"`) || lines[1].Time.IsZero() {
+		t.Errorf("受信したフレームがそのまま時刻付きで記録されることを期待しましたが、実際: %+v", lines[1:])
+	}
+}
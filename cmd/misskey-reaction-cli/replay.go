@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// runReplay runs the replay subcommand, which feeds a file written with the
+// record option through the same pipeline as notes received from the
+// streaming API.
+func runReplay(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configPath := fs.String("config", "config.yaml", "ルールなどを読み込む設定ファイルのパス")
+	live := fs.Bool("live", false, "ドライランではなく、インスタンスに対して実際にアクションを実行する")
+	speed := fs.Float64("speed", 1, "記録した間隔を何倍速で再生するか。0の場合は待たずに再生する")
+	auditPath := fs.String("audit", "", "判断を記録する監査ログのパス (省略時は記録しない)")
+	comparePath := fs.String("compare", "", "再生の判断と比べる監査ログのパス (稼働中のbotの audit.path など)")
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "使い方: %s replay [フラグ] <記録ファイル>\n", args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("記録ファイルを1つ指定してください")
+	}
+	if *speed < 0 {
+		err := errors.New("-speed に負の値は指定できません")
+		fmt.Fprintf(stderr, "エラー: %v\n", err)
+		return err
+	}
+	path := fs.Arg(0)
+	if _, err := os.Stat(path); err != nil {
+		fmt.Fprintf(stderr, "記録ファイルを開けませんでした: %v\n", err)
+		return err
+	}
+	if *comparePath != "" {
+		if _, err := os.Stat(*comparePath); err != nil {
+			fmt.Fprintf(stderr, "比較する監査ログを開けませんでした: %v\n", err)
+			return err
+		}
+		// 比べるために、-audit がなくても再生の判断を一時ファイルに記録する
+		if *auditPath == "" {
+			tmp, err := os.CreateTemp("", "replay-audit-*.jsonl")
+			if err != nil {
+				fmt.Fprintf(stderr, "エラー: %v\n", err)
+				return err
+			}
+			tmp.Close()
+			defer os.Remove(tmp.Name())
+			*auditPath = tmp.Name()
+		}
+	}
+
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "設定ファイルの読み込みに失敗しました: %v\n", err)
+		return err
+	}
+	prepareReplayConfig(config, *live, *auditPath)
+	logger, err := newLogger(stdout, config.LogFormat, config.LogLevel)
+	if err != nil {
+		fmt.Fprintf(stderr, "エラー: %v\n", err)
+		return err
+	}
+
+	a, err := newApp("", config, logger)
+	if err != nil {
+		logger.Error(err.Error())
+		return err
+	}
+	defer a.close()
+
+	errs := make([]error, len(a.accounts))
+	var wg sync.WaitGroup
+	for i, acc := range a.accounts {
+		wg.Add(1)
+		go func(i int, acc *account) {
+			defer wg.Done()
+			if err := replayAccount(acc, path, *speed, *live); err != nil {
+				errs[i] = accountError(acc.name, err)
+			}
+		}(i, acc)
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		logger.Error(err.Error())
+		return err
+	}
+
+	if *comparePath != "" {
+		if err := compareAudit(*comparePath, *auditPath, stdout); err != nil {
+			logger.Error(err.Error())
+			return err
+		}
+	}
+	return nil
+}
+
+// prepareReplayConfig changes the config so that a replay does not touch the
+// state of the running bot: no state, cooldown or audit files other than the
+// given auditPath, no backfill, no admin server and no recording. Unless live
+// is set, no Misskey API is called at all: custom emojis are not validated
+// against the instance either.
+func prepareReplayConfig(config *Config, live bool, auditPath string) {
+	config.StatePath, config.CooldownPath = "", ""
+	for i := range config.Accounts {
+		config.Accounts[i].StatePath, config.Accounts[i].CooldownPath = "", ""
+	}
+	config.Backfill.Enabled = false
+	config.ReconnectInterval = 0
+	config.Admin = AdminConfig{}
+	config.Record = RecordConfig{}
+	config.Audit = AuditConfig{Path: auditPath}
+	if !live {
+		config.DryRun = true
+		config.RecheckBeforeReaction = false
+		config.EmojiValidation.OnUnknown = emojiValidationOff
+	}
+}
+
+// replayAccount reads the frames recorded for the account from the file and
+// handles them like frames of the streaming API, waiting between them for the
+// recorded interval divided by speed. Each note is handled before the next
+// frame is read, with the clock of the bot set to the time it was recorded.
+// The notes of the account itself are told by the user ID in the recording;
+// unless live is set, the i API is not called when it is missing.
+func replayAccount(acc *account, path string, speed float64, live bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("記録ファイルを開けませんでした: %w", err)
+	}
+	defer file.Close()
+
+	// ノートの古さ、クールダウン、頻度制限は、フレームを記録した時刻を現在時刻として判定する
+	b := acc.currentBot()
+	var now time.Time
+	b.now = func() time.Time { return now }
+	delay := b.delay
+	b.delay = func() time.Duration {
+		if speed == 0 {
+			return 0
+		}
+		return time.Duration(float64(delay()) / speed)
+	}
+
+	if !live {
+		b.lookupSelf = func() (string, error) { return "", nil }
+	}
+
+	var channelIDs map[string]string
+	var last time.Time
+	frames, notes := 0, 0
+	err = readRecording(file, func(f recordedFrame) error {
+		if f.Account != acc.name {
+			return nil
+		}
+		if speed > 0 && !last.IsZero() && f.Time.After(last) {
+			time.Sleep(time.Duration(float64(f.Time.Sub(last)) / speed))
+		}
+		last, now = f.Time, f.Time
+
+		if f.UserID != "" {
+			b.selfMu.Lock()
+			b.selfID = f.UserID
+			b.selfMu.Unlock()
+			return nil
+		}
+		if f.Channels != nil {
+			channelIDs = subscriptionIDs(f.Channels)
+			return nil
+		}
+		frames++
+		handleStreamMessage([]byte(f.Data), channelIDs, acc.logger, func(n note) {
+			notes++
+			b.handleNote(n)
+		})
+		return nil
+	})
+	b.execs.Wait()
+	acc.logger.Info("記録ファイルを再生しました", "frames", frames, "notes", notes)
+	return err
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"misskey-reaction-cli/internal/audit"
+)
+
+// writeRecording は時刻を start から1分ずつ進めながら、自分のユーザーIDとチャンネルの行、フレームを記録します。
+func writeRecording(t *testing.T, path string, start time.Time, channels []string, frames ...string) {
+	t.Helper()
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	now := start
+	rec := newFrameRecorder(file)
+	rec.now = func() time.Time { return now }
+	rec.self(mockSelfID)
+	rec.subscribed(channels)
+	for _, frame := range frames {
+		now = now.Add(time.Minute)
+		rec.frame([]byte(frame))
+	}
+}
+
+// noteFrame はチャンネルにノートを配信するフレームです。
+func noteFrame(t *testing.T, id string, n note) string {
+	t.Helper()
+	event := streamNoteEvent{Type: "channel"}
+	event.Body.ID = id
+	event.Body.Type = "note"
+	event.Body.Body = n
+	data, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRunReplay(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	user := noteUser{ID: "user1"}
+	frames := func(t *testing.T) []string {
+		return []string{
+			noteFrame(t, "channel-0", note{ID: "note1", Text: "hello", User: user, CreatedAt: start}),
+			`{"type":"noteUpdated"}`,
+			"broken",
+			// 記録した時刻では作成から4分のため、max_note_age (5m) より新しい
+			noteFrame(t, "channel-1", note{ID: "note2", Text: "hello", User: noteUser{ID: "user2"}, CreatedAt: start}),
+			// クールダウン中
+			noteFrame(t, "channel-0", note{ID: "note3", Text: "hello", User: user, CreatedAt: start.Add(4 * time.Minute)}),
+			// 記録した時刻では作成から11分経っている
+			noteFrame(t, "channel-0", note{ID: "note4", Text: "hello", User: noteUser{ID: "user3"}, CreatedAt: start.Add(-5 * time.Minute)}),
+			// 自分のノート
+			noteFrame(t, "channel-0", note{ID: "note5", Text: "hello", User: noteUser{ID: mockSelfID}, CreatedAt: start.Add(6 * time.Minute)}),
+		}
+	}
+	tests := []struct {
+		name      string
+		args      []string
+		reactions []string
+		result    string
+	}{
+		{"ドライラン", nil, nil, audit.ResultDryRun},
+		{"アクションを実行", []string{"-live"}, []string{"note1", "note2"}, audit.ResultOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newMockMisskey(t, `{"emojis":[]}`)
+			dir := t.TempDir()
+			configPath := filepath.Join(dir, "config.yaml")
+			os.WriteFile(configPath, []byte(fmt.Sprintf(`
+misskey:
+  url: %q
+  token: "testToken"
+rules:
+  - name: "greet"
+    match_text: "hello"
+    emoji: "🎉"
+    cooldown: 30m
+max_note_age: 5m
+state_path: %q
+audit:
+  path: %q
+`, server.URL, filepath.Join(dir, "state.json"), filepath.Join(dir, "bot-audit.jsonl"))), 0644)
+			recording := filepath.Join(dir, "session.jsonl")
+			writeRecording(t, recording, start, []string{"homeTimeline", "localTimeline"}, frames(t)...)
+			auditPath := filepath.Join(dir, "audit.jsonl")
+
+			var stdout, stderr bytes.Buffer
+			args := append([]string{"misskey-reaction-cli", "-config", configPath, "-speed", "0", "-audit", auditPath}, tt.args...)
+			if err := runReplay(append(args, recording), &stdout, &stderr); err != nil {
+				t.Fatalf("再生に失敗しました: %v, %s", err, stderr.String())
+			}
+
+			// ドライランではカスタム絵文字の一覧の取得も含めて、APIを呼ばない
+			if tt.result == audit.ResultDryRun {
+				if paths := server.requestPaths(); len(paths) != 0 {
+					t.Errorf("APIを呼ばないことを期待しましたが、実際: %v", paths)
+				}
+			}
+
+			var reacted []string
+			for _, r := range server.sentReactions() {
+				reacted = append(reacted, r.NoteID)
+			}
+			if strings.Join(reacted, ",") != strings.Join(tt.reactions, ",") {
+				t.Errorf("リアクション 期待値: %v, 実際: %v", tt.reactions, reacted)
+			}
+
+			file, _ := os.Open(auditPath)
+			defer file.Close()
+			records, err := audit.Read(file)
+			if err != nil {
+				t.Fatalf("監査ログを読み込めませんでした: %v", err)
+			}
+			decisions := map[string]string{}
+			for _, r := range records {
+				switch r.Event {
+				case audit.EventSkip:
+					decisions[r.NoteID] = r.Reason
+				case audit.EventAction:
+					decisions[r.NoteID] = r.Result
+				case audit.EventReceived:
+					if r.NoteID == "note2" && (r.Channel != "localTimeline" || !r.Time.Equal(start.Add(4*time.Minute))) {
+						t.Errorf("記録したチャンネルと時刻を期待しましたが、実際: %+v", r)
+					}
+				}
+			}
+			expected := map[string]string{"note1": tt.result, "note2": tt.result, "note3": skipCooldown, "note4": skipAge, "note5": skipSelf}
+			if fmt.Sprint(decisions) != fmt.Sprint(expected) {
+				t.Errorf("判断 期待値: %v, 実際: %v", expected, decisions)
+			}
+
+			if _, err := os.Stat(filepath.Join(dir, "state.json")); !os.IsNotExist(err) {
+				t.Errorf("再生では状態ファイルを作成しないことを期待しましたが、実際: %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "bot-audit.jsonl")); !os.IsNotExist(err) {
+				t.Errorf("再生では設定ファイルの監査ログに書き込まないことを期待しましたが、実際: %v", err)
+			}
+			for _, expected := range []string{"WebSocketメッセージのパースに失敗しました", "記録ファイルを再生しました", "frames=7", "notes=5"} {
+				if !strings.Contains(stdout.String(), expected) {
+					t.Errorf("ログに '%s' が含まれていませんでした: %s", expected, stdout.String())
+				}
+			}
+		})
+	}
+}
+
+func TestRunReplay_Error(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{"記録ファイルなし", []string{}, "記録ファイルを1つ指定してください"},
+		{"負の速さ", []string{"-speed", "-1", "session.jsonl"}, "-speed に負の値は指定できません"},
+		{"存在しない記録ファイル", []string{filepath.Join(t.TempDir(), "missing.jsonl")}, "no such file or directory"},
+		{"存在しない比較する監査ログ", []string{"-compare", filepath.Join(t.TempDir(), "missing.jsonl"), "replay_test.go"}, "no such file or directory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			err := runReplay(append([]string{"misskey-reaction-cli"}, tt.args...), &stdout, &stderr)
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("エラー '%s' を期待しましたが、実際: %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestRunReplay_Compare(t *testing.T) {
+	server := newMockMisskey(t, `{"emojis":[]}`)
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	os.WriteFile(configPath, []byte(fmt.Sprintf(`
+misskey:
+  url: %q
+  token: "testToken"
+rules:
+  - name: "greet"
+    match_text: "hello"
+    emoji: "🎉"
+`, server.URL)), 0644)
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	recording := filepath.Join(dir, "session.jsonl")
+	writeRecording(t, recording, start, []string{"homeTimeline"},
+		noteFrame(t, "channel-0", note{ID: "note1", Text: "hello"}),
+		noteFrame(t, "channel-0", note{ID: "note2", Text: "bye"}),
+	)
+	// ルールを変える前の判断
+	baseline := filepath.Join(dir, "audit.jsonl")
+	writeAudit(t, baseline,
+		audit.Record{Event: audit.EventSkip, NoteID: "note1", Reason: skipFilter},
+		audit.Record{Event: audit.EventSkip, NoteID: "note2", Reason: skipFilter},
+	)
+
+	var stdout, stderr bytes.Buffer
+	if err := runReplay([]string{"misskey-reaction-cli", "-config", configPath, "-speed", "0", "-compare", baseline, recording}, &stdout, &stderr); err != nil {
+		t.Fatalf("再生に失敗しました: %v, %s", err, stderr.String())
+	}
+	expected := "監査ログとの比較: 比較したノート 2 件, 判断が変わったノート 1 件, 監査ログにないノート 0 件\n" +
+		"  note1: skip (filter) -> greet: reaction 🎉\n"
+	if !strings.HasSuffix(stdout.String(), expected) {
+		t.Errorf("出力の最後に %q を期待しましたが、実際: %q", expected, stdout.String())
+	}
+	if len(server.sentReactions()) != 0 {
+		t.Errorf("ドライランのためリアクションしないことを期待しましたが、実際: %+v", server.sentReactions())
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"misskey-reaction-cli/internal/emoji"
+	"misskey-reaction-cli/internal/mfm"
+	"misskey-reaction-cli/internal/textnorm"
+)
+
+// マッチングに使うテキストの種類
+const (
+	textModeRaw   = "raw"   // ノートのテキストをそのまま使う
+	textModePlain = "plain" // MFMを除去したテキストを使う
+)
+
+// firstEmojiVar はノート中の最初の絵文字に展開されるテンプレート変数です。
+const firstEmojiVar = "${first_emoji}"
+
+// テンプレート中のキャプチャグループ参照 ($1, ${1}, ${name})
+var captureRef = regexp.MustCompile(`\$(\d+|\{\w+\}|\w+)`)
+
+// Rule はリアクション対象のノートを判定する条件と付与するリアクションを表します。
+type Rule struct {
+	Name  string   `yaml:"name"`
+	Emoji EmojiSet `yaml:"emoji"`
+	// EmojiStrategy は絵文字が複数指定されたときの選択方式
+	EmojiStrategy string `yaml:"emoji_strategy"`
+	MatchText     string `yaml:"match_text"`
+	MatchType     string `yaml:"match_type"`
+	// TextMode はマッチングに使うテキストの種類 ("raw" または "plain")
+	TextMode string `yaml:"text_mode"`
+	// KeepEmoji はplainモードでカスタム絵文字(:name:)を残すかどうか
+	KeepEmoji bool `yaml:"keep_emoji"`
+	// Normalize はmatch_textとノートのテキストの両方に適用する正規化
+	Normalize textnorm.Options `yaml:"normalize"`
+	// RateLimit はこのルールのリアクションの頻度制限
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	// Cooldown は同じ投稿者に再びリアクションするまでの最短間隔 (例: 30m)
+	Cooldown time.Duration `yaml:"cooldown"`
+	// Schedule はこのルールが有効な時間帯
+	Schedule ScheduleConfig `yaml:"schedule"`
+	// Actions は一致したノートに対して行う操作。省略時はリアクションのみ
+	Actions []Action `yaml:"actions"`
+
+	picker   *emojiPicker
+	re       *regexp.Regexp
+	schedule *schedule
+}
+
+// rules returns the configured rules. When no rules are configured, the
+// legacy reaction block is used as the only rule.
+func (c *Config) rules() []Rule {
+	if len(c.Rules) > 0 {
+		return c.Rules
+	}
+	rule := Rule{
+		Name:      "reaction",
+		MatchText: c.Reaction.MatchText,
+		MatchType: c.Reaction.MatchType,
+	}
+	if c.Reaction.Emoji != "" {
+		rule.Emoji = EmojiSet{{Emoji: c.Reaction.Emoji}}
+	}
+	return []Rule{rule}
+}
+
+// prepareRules validates the rules and fills in default values.
+func prepareRules(rules []Rule) ([]Rule, error) {
+	prepared := make([]Rule, len(rules))
+	names := make(map[string]bool, len(rules))
+	for i, rule := range rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule%d", i+1)
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("エラー: ルール名 %s が重複しています", rule.Name)
+		}
+		names[rule.Name] = true
+		if rule.Cooldown < 0 {
+			return nil, fmt.Errorf("エラー: ルール %s のcooldownに負の値は指定できません", rule.Name)
+		}
+		if rule.MatchText == "" {
+			return nil, fmt.Errorf("エラー: ルール %s にリアクション対象の文字列(match_text)が指定されていません", rule.Name)
+		}
+		if rule.MatchType == "regex" {
+			re, err := regexp.Compile(rule.MatchText)
+			if err != nil {
+				return nil, fmt.Errorf("エラー: ルール %s の正規表現が不正です: %w", rule.Name, err)
+			}
+			rule.re = re
+		}
+		sched, err := newSchedule(rule.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("エラー: ルール %s: %w", rule.Name, err)
+		}
+		rule.schedule = sched
+		switch rule.TextMode {
+		case "":
+			rule.TextMode = textModeRaw
+		case textModeRaw, textModePlain:
+		default:
+			return nil, fmt.Errorf("エラー: ルール %s のtext_mode %q は不正です", rule.Name, rule.TextMode)
+		}
+		// リアクションが指定されていない場合はデフォルト値を使用
+		if len(rule.Emoji) == 0 {
+			rule.Emoji = EmojiSet{{Emoji: "👍"}}
+		}
+		picker, err := newEmojiPicker(rule.Emoji, rule.EmojiStrategy)
+		if err != nil {
+			return nil, fmt.Errorf("エラー: ルール %s: %w", rule.Name, err)
+		}
+		rule.picker = picker
+		for _, option := range rule.Emoji {
+			if err := rule.checkTemplate(option.Emoji); err != nil {
+				return nil, fmt.Errorf("エラー: ルール %s: %w", rule.Name, err)
+			}
+		}
+		// アクションは準備の際に変更するため、元の設定 (他のアカウントと共有している場合がある) とは別にする
+		rule.Actions = append([]Action(nil), rule.Actions...)
+		if err := rule.prepareActions(); err != nil {
+			return nil, fmt.Errorf("エラー: ルール %s: %w", rule.Name, err)
+		}
+		prepared[i] = rule
+	}
+	return prepared, nil
+}
+
+// pickEmoji returns the reaction to add to the given note.
+func (r *Rule) pickEmoji(noteID string) string {
+	return r.picker.pick(noteID)
+}
+
+// checkTemplate verifies that every capture group referenced by an emoji or
+// text template exists in the rule's regular expression.
+func (r *Rule) checkTemplate(template string) error {
+	stripped := strings.ReplaceAll(template, firstEmojiVar, "")
+	for _, m := range captureRef.FindAllStringSubmatch(stripped, -1) {
+		ref := strings.Trim(m[1], "{}")
+		if r.re == nil {
+			return fmt.Errorf("テンプレート %s はキャプチャグループを参照していますが、match_typeがregexではありません", template)
+		}
+		if n, err := strconv.Atoi(ref); err == nil {
+			if n > r.re.NumSubexp() {
+				return fmt.Errorf("テンプレート %s が参照するキャプチャグループ %d は存在しません", template, n)
+			}
+			continue
+		}
+		if r.re.SubexpIndex(ref) < 0 {
+			return fmt.Errorf("テンプレート %s が参照するキャプチャグループ %s は存在しません", template, ref)
+		}
+	}
+	return nil
+}
+
+// reaction returns the reaction to add to the note. Emoji templates are
+// expanded with the regular expression captures and the first emoji of the
+// note, and the result must be a single Unicode emoji or custom emoji code.
+func (r *Rule) reaction(noteID, noteText string) (string, error) {
+	template := r.pickEmoji(noteID)
+	if !strings.Contains(template, "$") {
+		return template, nil
+	}
+
+	reaction := r.expand(template, noteText)
+	if !emoji.IsUnicode(reaction) && !emoji.IsCustom(reaction) {
+		return "", fmt.Errorf("テンプレート %s を展開した %q は絵文字ではありません", template, reaction)
+	}
+	return reaction, nil
+}
+
+// expand expands the first emoji variable and the regular expression
+// captures in the template.
+func (r *Rule) expand(template, noteText string) string {
+	if !strings.Contains(template, "$") {
+		return template
+	}
+	expanded := strings.ReplaceAll(template, firstEmojiVar, emoji.First(noteText))
+	if r.re != nil {
+		subject := r.subject(noteText)
+		if m := r.re.FindStringSubmatchIndex(subject); m != nil {
+			expanded = string(r.re.ExpandString(nil, expanded, subject, m))
+		}
+	}
+	return expanded
+}
+
+// subject returns the text that the rule matches against.
+func (r *Rule) subject(noteText string) string {
+	if r.TextMode == textModePlain {
+		noteText = mfm.PlainText(noteText, mfm.Options{KeepEmoji: r.KeepEmoji})
+	}
+	return textnorm.Normalize(noteText, r.Normalize)
+}
+
+// match reports whether noteText satisfies the rule.
+func (r *Rule) match(noteText string) bool {
+	text := r.subject(noteText)
+	pattern := textnorm.Normalize(r.MatchText, r.Normalize)
+	switch r.MatchType {
+	case "prefix":
+		return strings.HasPrefix(text, pattern)
+	case "suffix":
+		return strings.HasSuffix(text, pattern)
+	case "contains", "": // デフォルトは部分一致
+		return strings.Contains(text, pattern)
+	case "regex":
+		return r.re != nil && r.re.MatchString(text)
+	default:
+		return false
+	}
+}
+
+// matchedText returns the part of the note text that matched the rule: the
+// whole regular expression match, or the normalized match_text otherwise.
+func (r *Rule) matchedText(noteText string) string {
+	if r.re != nil {
+		return r.re.FindString(r.subject(noteText))
+	}
+	return textnorm.Normalize(r.MatchText, r.Normalize)
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"misskey-reaction-cli/internal/textnorm"
+)
+
+func TestRuleMatch_TextMode(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     Rule
+		noteText string
+		expected bool
+	}{
+		{"raw_装飾ありは前方一致しない", Rule{MatchText: "おはよう", MatchType: "prefix", TextMode: textModeRaw}, "$[tada おはよう]", false},
+		{"plain_装飾を除去して前方一致", Rule{MatchText: "おはよう", MatchType: "prefix", TextMode: textModePlain}, "$[tada おはよう]", true},
+		{"plain_絵文字を除去して後方一致", Rule{MatchText: "おやすみ", MatchType: "suffix", TextMode: textModePlain}, "**おやすみ** :sleep:", true},
+		{"plain_URLを除去して後方一致", Rule{MatchText: "見て", MatchType: "suffix", TextMode: textModePlain}, "見て https://example.com", true},
+		{"plain_絵文字を保持", Rule{MatchText: ":sleep:", MatchType: "suffix", TextMode: textModePlain, KeepEmoji: true}, "<small>おやすみ</small> :sleep:", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.match(tt.noteText); got != tt.expected {
+				t.Errorf("期待値: %v, 実際: %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestConfigRules_Legacy(t *testing.T) {
+	config := &Config{}
+	config.Reaction.Emoji = "🎉"
+	config.Reaction.MatchText = "hello"
+
+	rules := config.rules()
+	if len(rules) != 1 {
+		t.Fatalf("ルール数 1 を期待しましたが、%d でした", len(rules))
+	}
+	if len(rules[0].Emoji) != 1 || rules[0].Emoji[0].Emoji != "🎉" || rules[0].MatchText != "hello" {
+		t.Errorf("reactionブロックがルールに変換されていません: %+v", rules[0])
+	}
+
+	config.Rules = []Rule{{MatchText: "a"}, {MatchText: "b"}}
+	if len(config.rules()) != 2 {
+		t.Errorf("rulesが指定されている場合はrulesを使うことを期待しました")
+	}
+}
+
+func TestConfigRules_LegacyRegex(t *testing.T) {
+	config := &Config{}
+	config.Reaction.MatchText = "^おは(よう|よー)"
+	config.Reaction.MatchType = "regex"
+
+	// reactionブロックもrulesと同じくprepareRulesを通るため、正規表現が使える
+	rules, err := prepareRules(config.rules())
+	if err != nil {
+		t.Fatalf("エラーが発生しないことを期待しましたが、発生しました: %v", err)
+	}
+	if !rules[0].match("おはよー") || rules[0].match("みなさんおはよう") {
+		t.Errorf("正規表現で判定することを期待しました: %+v", rules[0])
+	}
+}
+
+func TestPrepareRules(t *testing.T) {
+	rules, err := prepareRules([]Rule{{MatchText: "hello"}})
+	if err != nil {
+		t.Fatalf("エラーが発生しないことを期待しましたが、発生しました: %v", err)
+	}
+	if rules[0].Name != "rule1" || rules[0].pickEmoji("note") != "👍" || rules[0].TextMode != textModeRaw {
+		t.Errorf("デフォルト値が設定されていません: %+v", rules[0])
+	}
+
+	if _, err := prepareRules([]Rule{{MatchText: "hello", TextMode: "invalid"}}); err == nil || !strings.Contains(err.Error(), "text_mode") {
+		t.Errorf("不正なtext_modeでエラーになることを期待しましたが、実際: %v", err)
+	}
+	if _, err := prepareRules([]Rule{{Name: "empty"}}); err == nil || !strings.Contains(err.Error(), "match_text") {
+		t.Errorf("match_textがない場合にエラーになることを期待しましたが、実際: %v", err)
+	}
+	if _, err := prepareRules([]Rule{{Name: "a", MatchText: "x"}, {Name: "a", MatchText: "y"}}); err == nil || !strings.Contains(err.Error(), "重複") {
+		t.Errorf("ルール名が重複している場合にエラーになることを期待しましたが、実際: %v", err)
+	}
+}
+
+func TestRuleMatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		matchType string
+		noteText  string
+		matchText string
+		expected  bool
+	}{
+		{"前方一致_一致", "prefix", "hello world", "hello", true},
+		{"前方一致_不一致", "prefix", "hello world", "world", false},
+		{"後方一致_一致", "suffix", "hello world", "world", true},
+		{"後方一致_不一致", "suffix", "hello world", "hello", false},
+		{"部分一致_一致", "contains", "hello world", "lo wo", true},
+		{"部分一致_不一致", "contains", "hello world", "wollo", false},
+		{"デフォルト(部分一致)_一致", "", "hello world", "lo wo", true},
+		{"デフォルト(部分一致)_不一致", "", "hello world", "wollo", false},
+		{"正規表現_一致", "regex", "hello world", `^h\w+ w`, true},
+		{"正規表現_不一致", "regex", "hello world", `^world`, false},
+		{"無効なタイプ", "invalid", "hello world", "hello", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{
+				Reaction: struct {
+					Emoji     string `yaml:"emoji"`
+					MatchText string `yaml:"match_text"`
+					MatchType string `yaml:"match_type"`
+				}{
+					MatchText: tt.matchText,
+					MatchType: tt.matchType,
+				},
+			}
+			// 旧形式の reaction の設定も、ルールと同じく準備してから判定する
+			rules, err := prepareRules(config.rules())
+			if err != nil {
+				t.Fatalf("ルールの準備に失敗しました: %v", err)
+			}
+			if rules[0].match(tt.noteText) != tt.expected {
+				t.Errorf("期待値: %v, 実際: %v", tt.expected, !tt.expected)
+			}
+		})
+	}
+}
+
+func TestBotFindActiveRule(t *testing.T) {
+	server := newMockMisskey(t, `{"emojis":[]}`)
+	b, _ := newTestBot(t, testConfig(server.URL,
+		Rule{Name: "first", MatchText: "おはよう"},
+		Rule{Name: "second", MatchText: "おはようございます"},
+	))
+
+	if rule := b.findActiveRule(note{ID: "note1", Text: "おはようございます"}); rule == nil || rule.Name != "first" {
+		t.Errorf("最初に一致したルールを期待しましたが、実際: %+v", rule)
+	}
+	if rule := b.findActiveRule(note{ID: "note2", Text: "こんばんは"}); rule != nil {
+		t.Errorf("一致するルールがないことを期待しましたが、実際: %+v", rule)
+	}
+}
+
+func TestRuleMatch_Normalize(t *testing.T) {
+	tests := []struct {
+		name      string
+		matchText string
+		matchType string
+		normalize textnorm.Options
+		noteText  string
+		expected  bool
+	}{
+		{"正規化なし_全角は一致しない", "misskey", "contains", textnorm.Options{}, "ＭＩＳＳＫＥＹ最高", false},
+		{"NFKCと大文字小文字", "misskey", "contains", textnorm.Options{NFKC: true, FoldCase: true}, "ＭＩＳＳＫＥＹ最高", true},
+		{"パターン側も正規化", "ＯＨＡＹＯ", "prefix", textnorm.Options{NFKC: true, FoldCase: true}, "ohayo!", true},
+		{"カタカナとひらがな", "おはよう", "prefix", textnorm.Options{FoldKana: true}, "オハヨウございます", true},
+		{"半角カナとひらがな", "おつかれ", "suffix", textnorm.Options{NFKC: true, FoldKana: true}, "今日もｵﾂｶﾚ", true},
+		{"空白の揺れ", "お疲れ様 です", "contains", textnorm.Options{CollapseSpace: true}, "今日もお疲れ様　　です！", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := Rule{MatchText: tt.matchText, MatchType: tt.matchType, Normalize: tt.normalize}
+			if got := rule.match(tt.noteText); got != tt.expected {
+				t.Errorf("期待値: %v, 実際: %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRuleReaction_Template(t *testing.T) {
+	tests := []struct {
+		name      string
+		rule      Rule
+		noteText  string
+		expected  string
+		expectErr bool
+	}{
+		{"キャプチャグループ", Rule{MatchType: "regex", MatchText: `今日の気分: (\S+)`, Emoji: EmojiSet{{Emoji: "$1"}}}, "今日の気分: 🍣", "🍣", false},
+		{"名前付きキャプチャグループ", Rule{MatchType: "regex", MatchText: `気分: (?P<mood>:\w+:)`, Emoji: EmojiSet{{Emoji: "${mood}"}}}, "気分: :sushi:", ":sushi:", false},
+		{"最初の絵文字", Rule{MatchText: "今日の気分", Emoji: EmojiSet{{Emoji: firstEmojiVar}}}, "今日の気分: 🍣🍺", "🍣", false},
+		{"絵文字でないキャプチャ", Rule{MatchType: "regex", MatchText: `今日の気分: (\S+)`, Emoji: EmojiSet{{Emoji: "$1"}}}, "今日の気分: 普通", "", true},
+		{"絵文字がない", Rule{MatchText: "今日の気分", Emoji: EmojiSet{{Emoji: firstEmojiVar}}}, "今日の気分: 普通", "", true},
+		{"テンプレートでない", Rule{MatchText: "今日の気分", Emoji: EmojiSet{{Emoji: "👍"}}}, "今日の気分: 🍣", "👍", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := prepareRules([]Rule{tt.rule})
+			if err != nil {
+				t.Fatalf("ルールの準備に失敗しました: %v", err)
+			}
+			if !rules[0].match(tt.noteText) {
+				t.Fatalf("ルールが一致することを期待しました")
+			}
+			got, err := rules[0].reaction("note", tt.noteText)
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("エラーを期待しましたが、%q が返されました", got)
+				}
+				return
+			}
+			if err != nil || got != tt.expected {
+				t.Errorf("期待値: %q, 実際: %q (エラー: %v)", tt.expected, got, err)
+			}
+		})
+	}
+}
+
+func TestPrepareRules_TemplateError(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     Rule
+		expected string
+	}{
+		{"不正な正規表現", Rule{MatchType: "regex", MatchText: "("}, "正規表現が不正です"},
+		{"regexでないのにキャプチャ参照", Rule{MatchText: "a", Emoji: EmojiSet{{Emoji: "$1"}}}, "match_typeがregexではありません"},
+		{"存在しない番号", Rule{MatchType: "regex", MatchText: "(a)", Emoji: EmojiSet{{Emoji: "$2"}}}, "キャプチャグループ 2 は存在しません"},
+		{"存在しない名前", Rule{MatchType: "regex", MatchText: "(?P<x>a)", Emoji: EmojiSet{{Emoji: "${y}"}}}, "キャプチャグループ y は存在しません"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := prepareRules([]Rule{tt.rule})
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("エラー '%s' を期待しましたが、実際: %v", tt.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ScheduleConfig はルールや全体が有効になる時間帯の設定です。
+type ScheduleConfig struct {
+	// Timezone は時間帯の解釈に使うタイムゾーン (例: Asia/Tokyo)。省略時はローカル時刻
+	Timezone string `yaml:"timezone"`
+	// Active は有効な時間帯。いずれかに当てはまれば有効。省略時は常に有効
+	Active []TimeWindow `yaml:"active"`
+	// Quiet は無効にする時間帯。Activeより優先される
+	Quiet []TimeWindow `yaml:"quiet"`
+}
+
+// TimeWindow は曜日と時刻の範囲、またはcron形式で時間帯を表します。
+type TimeWindow struct {
+	// Weekdays は曜日 (sun, mon, tue, wed, thu, fri, sat)。省略時は毎日
+	Weekdays []string `yaml:"weekdays"`
+	// Hours は "09:00-18:00" 形式の時刻の範囲 (終了時刻は含まない)。"22:00-06:00" のように日をまたいでもよい
+	Hours string `yaml:"hours"`
+	// Cron は "分 時 日 月 曜日" 形式。一致する分の間を有効とする
+	Cron string `yaml:"cron"`
+}
+
+// scheduleHorizon は次に有効になる時刻を探す範囲です。
+const scheduleHorizon = 8 * 24 * time.Hour
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// schedule is a compiled ScheduleConfig. A nil schedule is always active.
+type schedule struct {
+	loc    *time.Location
+	active []window
+	quiet  []window
+}
+
+// window は1つの時間帯の判定です。
+type window interface {
+	contains(t time.Time) bool
+}
+
+// newSchedule compiles the config. It returns nil when no window is configured.
+func newSchedule(c ScheduleConfig) (*schedule, error) {
+	if len(c.Active) == 0 && len(c.Quiet) == 0 {
+		return nil, nil
+	}
+	s := &schedule{loc: time.Local}
+	if c.Timezone != "" {
+		loc, err := time.LoadLocation(c.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("schedule.timezone %q は不正です: %w", c.Timezone, err)
+		}
+		s.loc = loc
+	}
+	var err error
+	if s.active, err = compileWindows(c.Active); err != nil {
+		return nil, err
+	}
+	if s.quiet, err = compileWindows(c.Quiet); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func compileWindows(windows []TimeWindow) ([]window, error) {
+	compiled := make([]window, len(windows))
+	for i, w := range windows {
+		var err error
+		if w.Cron != "" {
+			if len(w.Weekdays) > 0 || w.Hours != "" {
+				return nil, fmt.Errorf("scheduleのcronとweekdays/hoursは同時に指定できません")
+			}
+			compiled[i], err = parseCron(w.Cron)
+		} else {
+			compiled[i], err = parseWeeklyWindow(w)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return compiled, nil
+}
+
+// isActive reports whether the schedule is active at t.
+func (s *schedule) isActive(t time.Time) bool {
+	if s == nil {
+		return true
+	}
+	t = t.In(s.loc)
+	for _, w := range s.quiet {
+		if w.contains(t) {
+			return false
+		}
+	}
+	if len(s.active) == 0 {
+		return true
+	}
+	for _, w := range s.active {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// scheduleSet は全てのスケジュールが有効なときに有効になります (全体とルールの組み合わせ)。
+type scheduleSet []*schedule
+
+func (ss scheduleSet) isActive(t time.Time) bool {
+	for _, s := range ss {
+		if !s.isActive(t) {
+			return false
+		}
+	}
+	return true
+}
+
+// nextActive returns the first minute at or after t at which the set is
+// active. It returns false when the set is not active within scheduleHorizon.
+func (ss scheduleSet) nextActive(t time.Time) (time.Time, bool) {
+	if ss.isActive(t) {
+		return t, true
+	}
+	t = t.Truncate(time.Minute)
+	for end := t.Add(scheduleHorizon); t.Before(end); t = t.Add(time.Minute) {
+		if ss.isActive(t) {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// weeklyWindow は曜日と時刻の範囲です。
+type weeklyWindow struct {
+	days       [7]bool
+	start, end int // 0時からの分
+}
+
+func parseWeeklyWindow(w TimeWindow) (*weeklyWindow, error) {
+	ww := &weeklyWindow{start: 0, end: 24 * 60}
+	if len(w.Weekdays) == 0 {
+		ww.days = [7]bool{true, true, true, true, true, true, true}
+	}
+	for _, name := range w.Weekdays {
+		day, ok := weekdayNames[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("scheduleの曜日 %q は不正です", name)
+		}
+		ww.days[day] = true
+	}
+	if w.Hours != "" {
+		from, to, ok := strings.Cut(w.Hours, "-")
+		if !ok {
+			return nil, fmt.Errorf("scheduleのhours %q は HH:MM-HH:MM 形式で指定してください", w.Hours)
+		}
+		var err error
+		if ww.start, err = parseClock(from); err != nil {
+			return nil, err
+		}
+		if ww.end, err = parseClock(to); err != nil {
+			return nil, err
+		}
+	}
+	return ww, nil
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		if strings.TrimSpace(s) == "24:00" {
+			return 24 * 60, nil
+		}
+		return 0, fmt.Errorf("scheduleの時刻 %q は不正です", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (w *weeklyWindow) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	if w.start <= w.end {
+		return w.days[t.Weekday()] && w.start <= minute && minute < w.end
+	}
+	// 日をまたぐ範囲は、開始した日の曜日で判定する
+	if minute >= w.start {
+		return w.days[t.Weekday()]
+	}
+	return minute < w.end && w.days[(t.Weekday()+6)%7]
+}
+
+// cronWindow は "分 時 日 月 曜日" 形式の時間帯です。
+type cronWindow struct {
+	minute, hour, dom, month, dow []bool
+	domAny, dowAny                bool
+}
+
+func parseCron(spec string) (*cronWindow, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("scheduleのcron %q は5つのフィールドで指定してください", spec)
+	}
+	c := &cronWindow{domAny: fields[2] == "*", dowAny: fields[4] == "*"}
+	var err error
+	if c.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, err
+	}
+	if c.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, err
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, err
+	}
+	if c.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, err
+	}
+	// 日曜日は0と7のどちらでも指定できる
+	c.dow[0] = c.dow[0] || c.dow[7]
+	return c, nil
+}
+
+// parseCronField parses a field such as "*", "*/15", "1-5", "9-17/2" or "1,3,5".
+func parseCronField(field string, lower, upper int) ([]bool, error) {
+	set := make([]bool, upper+1)
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step <= 0 {
+				return nil, fmt.Errorf("cronのフィールド %q は不正です", field)
+			}
+		}
+		lo, hi := lower, upper
+		if rangePart != "*" {
+			from, to, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if lo, err = strconv.Atoi(from); err != nil {
+				return nil, fmt.Errorf("cronのフィールド %q は不正です", field)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(to); err != nil {
+					return nil, fmt.Errorf("cronのフィールド %q は不正です", field)
+				}
+			} else if hasStep {
+				hi = upper
+			}
+		}
+		if lo < lower || hi > upper || lo > hi {
+			return nil, fmt.Errorf("cronのフィールド %q は %d から %d の範囲で指定してください", field, lower, upper)
+		}
+		for v := lo; v <= hi; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
+
+func (c *cronWindow) contains(t time.Time) bool {
+	if !c.minute[t.Minute()] || !c.hour[t.Hour()] || !c.month[t.Month()] {
+		return false
+	}
+	dom, dow := c.dom[t.Day()], c.dow[t.Weekday()]
+	// cronと同じく、日と曜日の両方が指定された場合はどちらかに一致すればよい
+	if !c.domAny && !c.dowAny {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// runSchedule implements the "schedule" subcommand, which prints when the bot
+// and each rule are next active.
+func runSchedule(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configPath := fs.String("config", "config.yaml", "設定ファイルのパス")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "設定ファイルの読み込みに失敗しました: %v\n", err)
+		return err
+	}
+	global, err := newSchedule(config.Schedule)
+	if err != nil {
+		fmt.Fprintf(stderr, "エラー: %v\n", err)
+		return err
+	}
+	accounts, err := config.accounts()
+	if err != nil {
+		fmt.Fprintf(stderr, "エラー: %v\n", err)
+		return err
+	}
+
+	now := time.Now()
+	fmt.Fprintf(stdout, "全体: %s\n", describeSchedule(scheduleSet{global}, now))
+	for _, a := range accounts {
+		rules, err := prepareRules(a.config.rules())
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return err
+		}
+		prefix := ""
+		if a.name != "" {
+			prefix = "アカウント " + a.name + " の"
+		}
+		for _, rule := range rules {
+			fmt.Fprintf(stdout, "%sルール %s: %s\n", prefix, rule.Name, describeSchedule(scheduleSet{global, rule.schedule}, now))
+		}
+	}
+	return nil
+}
+
+// describeSchedule returns a human-readable description of when ss is next active.
+func describeSchedule(ss scheduleSet, now time.Time) string {
+	alwaysActive := true
+	for _, s := range ss {
+		if s != nil {
+			alwaysActive = false
+			now = now.In(s.loc)
+		}
+	}
+	switch next, ok := ss.nextActive(now); {
+	case alwaysActive:
+		return "常に有効"
+	case !ok:
+		return fmt.Sprintf("%d日以内に有効になる時間帯はありません", int(scheduleHorizon.Hours()/24))
+	case next.Equal(now):
+		return "現在有効"
+	default:
+		return "次に有効になる時刻: " + next.Format("2006-01-02 15:04 MST (Mon)")
+	}
+}
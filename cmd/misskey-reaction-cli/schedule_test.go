@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustSchedule(t *testing.T, c ScheduleConfig) *schedule {
+	t.Helper()
+	s, err := newSchedule(c)
+	if err != nil {
+		t.Fatalf("スケジュールの作成に失敗しました: %v", err)
+	}
+	return s
+}
+
+func TestSchedule_IsActive(t *testing.T) {
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+	at := func(day, hour, minute int) time.Time {
+		// 2024-01-01 は月曜日
+		return time.Date(2024, 1, day, hour, minute, 0, 0, tokyo)
+	}
+
+	workHours := ScheduleConfig{
+		Timezone: "Asia/Tokyo",
+		Active:   []TimeWindow{{Weekdays: []string{"mon", "tue", "wed", "thu", "fri"}, Hours: "09:00-18:00"}},
+		Quiet:    []TimeWindow{{Hours: "12:00-13:00"}},
+	}
+	overnight := ScheduleConfig{
+		Timezone: "Asia/Tokyo",
+		Active:   []TimeWindow{{Weekdays: []string{"fri"}, Hours: "22:00-02:00"}},
+	}
+	cron := ScheduleConfig{
+		Timezone: "Asia/Tokyo",
+		Active:   []TimeWindow{{Cron: "*/30 9-17 * * 1-5"}},
+	}
+
+	tests := []struct {
+		name     string
+		config   ScheduleConfig
+		t        time.Time
+		expected bool
+	}{
+		{"平日の業務時間", workHours, at(1, 9, 0), true},
+		{"平日の業務時間外", workHours, at(1, 18, 0), false},
+		{"昼休み", workHours, at(1, 12, 30), false},
+		{"土曜日", workHours, at(6, 10, 0), false},
+		{"UTCで指定しても東京時間で判定", workHours, time.Date(2024, 1, 1, 0, 30, 0, 0, time.UTC), true},
+		{"日またぎ_開始日", overnight, at(5, 23, 0), true},
+		{"日またぎ_翌日", overnight, at(6, 1, 59), true},
+		{"日またぎ_終了後", overnight, at(6, 2, 0), false},
+		{"日またぎ_前日が対象外", overnight, at(5, 1, 0), false},
+		{"cron_一致", cron, at(1, 9, 30), true},
+		{"cron_分が不一致", cron, at(1, 9, 31), false},
+		{"cron_曜日が不一致", cron, at(7, 9, 30), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mustSchedule(t, tt.config).isActive(tt.t); got != tt.expected {
+				t.Errorf("期待値: %v, 実際: %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestSchedule_Nil(t *testing.T) {
+	s := mustSchedule(t, ScheduleConfig{Timezone: "Asia/Tokyo"})
+	if s != nil {
+		t.Fatal("時間帯がない場合はnilを期待しました")
+	}
+	if !s.isActive(time.Now()) {
+		t.Error("nilのスケジュールは常に有効であることを期待しました")
+	}
+}
+
+func TestScheduleSet_NextActive(t *testing.T) {
+	global := mustSchedule(t, ScheduleConfig{
+		Timezone: "UTC",
+		Quiet:    []TimeWindow{{Weekdays: []string{"sat", "sun"}}},
+	})
+	rule := mustSchedule(t, ScheduleConfig{
+		Timezone: "UTC",
+		Active:   []TimeWindow{{Hours: "09:00-10:00"}},
+	})
+
+	// 2024-01-06 (土) 12:00 の次は 2024-01-08 (月) 09:00
+	now := time.Date(2024, 1, 6, 12, 0, 0, 0, time.UTC)
+	next, ok := scheduleSet{global, rule}.nextActive(now)
+	if expected := time.Date(2024, 1, 8, 9, 0, 0, 0, time.UTC); !ok || !next.Equal(expected) {
+		t.Errorf("期待値: %v, 実際: %v (%v)", expected, next, ok)
+	}
+
+	never := mustSchedule(t, ScheduleConfig{Active: []TimeWindow{{Cron: "0 0 30 2 *"}}})
+	if _, ok := (scheduleSet{never}).nextActive(now); ok {
+		t.Error("有効にならないスケジュールではfalseを期待しました")
+	}
+}
+
+func TestNewSchedule_Error(t *testing.T) {
+	tests := []struct {
+		name   string
+		config ScheduleConfig
+	}{
+		{"不正なタイムゾーン", ScheduleConfig{Timezone: "Invalid/Zone", Active: []TimeWindow{{Hours: "09:00-10:00"}}}},
+		{"不正な曜日", ScheduleConfig{Active: []TimeWindow{{Weekdays: []string{"xyz"}}}}},
+		{"不正な時刻", ScheduleConfig{Active: []TimeWindow{{Hours: "9時-10時"}}}},
+		{"区切りがない", ScheduleConfig{Active: []TimeWindow{{Hours: "09:00"}}}},
+		{"cronのフィールド数", ScheduleConfig{Active: []TimeWindow{{Cron: "* * *"}}}},
+		{"cronの範囲外", ScheduleConfig{Active: []TimeWindow{{Cron: "0 24 * * *"}}}},
+		{"cronとhoursの併用", ScheduleConfig{Active: []TimeWindow{{Cron: "* * * * *", Hours: "09:00-10:00"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newSchedule(tt.config); err == nil {
+				t.Error("エラーを期待しましたが、発生しませんでした")
+			}
+		})
+	}
+}
+
+func TestRun_ScheduleSubcommand(t *testing.T) {
+	configContent := `
+misskey:
+  url: "https://test.misskey.example.com"
+  token: "test_token_123"
+rules:
+  - name: "always"
+    match_text: "hello"
+  - name: "never"
+    match_text: "bye"
+    schedule:
+      active:
+        - cron: "0 0 30 2 *"
+`
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(configContent), 0o644); err != nil {
+		t.Fatalf("設定ファイルの作成に失敗しました: %v", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if err := run([]string{"cmd", "schedule", "-config", path}, &stdout, &stderr); err != nil {
+		t.Fatalf("エラーが発生しないことを期待しましたが、発生しました: %v, %s", err, stderr.String())
+	}
+	for _, expected := range []string{"全体: 常に有効", "ルール always: 常に有効", "ルール never: 8日以内に有効になる時間帯はありません"} {
+		if !strings.Contains(stdout.String(), expected) {
+			t.Errorf("出力に '%s' が含まれていませんでした: %s", expected, stdout.String())
+		}
+	}
+}
+
+func TestRun_UnknownSubcommand(t *testing.T) {
+	var stderr bytes.Buffer
+	if err := run([]string{"cmd", "unknown"}, nil, &stderr); err == nil {
+		t.Fatal("エラーが発生することを期待しましたが、発生しませんでした")
+	}
+	if !strings.Contains(stderr.String(), "不明なサブコマンドです: unknown") {
+		t.Errorf("期待するエラーが含まれていませんでした: %s", stderr.String())
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// seenCapacity は重複処理を防ぐために覚えておくノートIDの数です。
+const seenCapacity = 10000
+
+// stateSaveInterval は状態ファイルを書き込む最短間隔です。
+const stateSaveInterval = 5 * time.Second
+
+// noteState は最後に処理したノートIDと、処理済みのノートIDを保持します。
+// 最後に処理したノートIDはバックフィルの起点として state_path に保存されます。
+type noteState struct {
+	path string
+
+	mu         sync.Mutex
+	lastNoteID string
+	seen       map[string]bool
+	order      []string // seenから古いものを捨てるための順序
+	lastSave   time.Time
+	dirty      bool
+}
+
+// savedState は状態ファイルの形式です。
+type savedState struct {
+	LastNoteID string `json:"last_note_id"`
+}
+
+// loadNoteState creates a state and loads the last note ID from path when the
+// file exists. An empty path keeps the state in memory only.
+func loadNoteState(path string) (*noteState, error) {
+	s := &noteState{path: path, seen: make(map[string]bool)}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("状態ファイルの読み込みに失敗しました: %w", err)
+	}
+	var saved savedState
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("状態ファイルのパースに失敗しました: %w", err)
+	}
+	s.lastNoteID = saved.LastNoteID
+	return s, nil
+}
+
+// markSeen records that the note has been processed. It returns false when
+// the note was already processed.
+func (s *noteState) markSeen(noteID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.seen[noteID] {
+		return false
+	}
+	s.seen[noteID] = true
+	s.order = append(s.order, noteID)
+	if len(s.order) > seenCapacity {
+		delete(s.seen, s.order[0])
+		s.order = s.order[1:]
+	}
+	if s.lastNoteID == "" || noteIDLess(s.lastNoteID, noteID) {
+		s.lastNoteID = noteID
+		s.dirty = true
+	}
+	return true
+}
+
+// last returns the newest processed note ID.
+func (s *noteState) last() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastNoteID
+}
+
+// save writes the last note ID to the file. Unless force is set, writes are
+// skipped when the previous write was less than stateSaveInterval ago.
+func (s *noteState) save(now time.Time, force bool) error {
+	s.mu.Lock()
+	if s.path == "" || !s.dirty || (!force && now.Sub(s.lastSave) < stateSaveInterval) {
+		s.mu.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(savedState{LastNoteID: s.lastNoteID})
+	s.dirty = false
+	s.lastSave = now
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, data)
+}
+
+// writeFileAtomic writes data to a temporary file and renames it to path so
+// that an interrupted write never leaves a broken file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNoteState_MarkSeen(t *testing.T) {
+	s, err := loadNoteState("")
+	if err != nil {
+		t.Fatalf("作成に失敗しました: %v", err)
+	}
+
+	if !s.markSeen("9a") {
+		t.Fatal("初回は処理することを期待しました")
+	}
+	if s.markSeen("9a") {
+		t.Error("同じノートは二度処理しないことを期待しました")
+	}
+	// 古いノートを後から処理しても最後のノートIDは戻らない
+	s.markSeen("99")
+	if last := s.last(); last != "9a" {
+		t.Errorf("最後のノートID 9a を期待しましたが、実際: %s", last)
+	}
+
+	for i := 0; i < seenCapacity; i++ {
+		s.markSeen(fmt.Sprintf("z%05d", i))
+	}
+	if !s.markSeen("9a") {
+		t.Error("上限を超えた古いノートIDは忘れることを期待しました")
+	}
+}
+
+func TestNoteState_Persist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	s, err := loadNoteState(path)
+	if err != nil {
+		t.Fatalf("作成に失敗しました: %v", err)
+	}
+	s.markSeen("9a")
+	if err := s.save(now, false); err != nil {
+		t.Fatalf("保存に失敗しました: %v", err)
+	}
+	s.markSeen("9b")
+	if err := s.save(now.Add(time.Second), false); err != nil {
+		t.Fatalf("保存に失敗しました: %v", err)
+	}
+	if restored, _ := loadNoteState(path); restored.last() != "9a" {
+		t.Errorf("間隔内の保存は省略されることを期待しましたが、実際: %s", restored.last())
+	}
+
+	if err := s.save(now.Add(time.Second), true); err != nil {
+		t.Fatalf("保存に失敗しました: %v", err)
+	}
+	restored, err := loadNoteState(path)
+	if err != nil {
+		t.Fatalf("読み込みに失敗しました: %v", err)
+	}
+	if restored.last() != "9b" {
+		t.Errorf("最後のノートID 9b が引き継がれることを期待しましたが、実際: %s", restored.last())
+	}
+}
+
+func TestLoadNoteState_InvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	os.WriteFile(path, []byte("not json"), 0644)
+
+	if _, err := loadNoteState(path); err == nil || !strings.Contains(err.Error(), "状態ファイルのパースに失敗しました") {
+		t.Errorf("パースのエラーを期待しましたが、実際: %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// textData は quote と reply の本文のテンプレートに渡す値です。
+type textData struct {
+	ID        string
+	Text      string
+	CreatedAt time.Time
+	User      noteUser
+	// Rule は一致したルールの名前
+	Rule string
+	// Captures は正規表現のキャプチャ ("0" は一致した全体、"1" 以降は番号、名前付きグループは名前)
+	Captures map[string]string
+}
+
+// templateFuncs はテンプレートで使える関数です。外部に影響する関数は含めない。
+var templateFuncs = template.FuncMap{
+	"truncate": truncate,
+	"pickLine": pickLine,
+}
+
+// templateIntn は pickLine の乱数です (テストで置き換える)。
+var templateIntn = rand.Intn
+
+// parseTextTemplate parses a reply or quote text template and checks it by
+// executing it with an empty note, so that unknown fields are reported when
+// the config is loaded.
+func parseTextTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("text").Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("テンプレートのパースに失敗しました: %w", err)
+	}
+	if err := tmpl.Execute(&strings.Builder{}, textData{Captures: map[string]string{}}); err != nil {
+		return nil, fmt.Errorf("テンプレートが不正です: %w", err)
+	}
+	return tmpl, nil
+}
+
+// renderText executes the action's text template for the note.
+func (r *Rule) renderText(action Action, n note) (string, error) {
+	data := textData{
+		ID:        n.ID,
+		Text:      n.Text,
+		CreatedAt: n.CreatedAt,
+		User:      n.User,
+		Rule:      r.Name,
+		Captures:  r.captures(n.Text),
+	}
+	var b strings.Builder
+	if err := action.tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("テンプレートの実行に失敗しました: %w", err)
+	}
+	return b.String(), nil
+}
+
+// captures returns the regular expression captures of the note text by
+// number and by name.
+func (r *Rule) captures(noteText string) map[string]string {
+	captures := map[string]string{}
+	if r.re == nil {
+		return captures
+	}
+	m := r.re.FindStringSubmatch(r.subject(noteText))
+	for i, name := range r.re.SubexpNames() {
+		if i >= len(m) {
+			break
+		}
+		captures[strconv.Itoa(i)] = m[i]
+		if name != "" {
+			captures[name] = m[i]
+		}
+	}
+	return captures
+}
+
+// truncate shortens s to at most n characters, adding "…" when cut.
+func truncate(n int, s string) string {
+	runes := []rune(s)
+	if n < 0 || len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "…"
+}
+
+// pickLine returns a random non-empty line of s.
+func pickLine(s string) string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return lines[templateIntn(len(lines))]
+}
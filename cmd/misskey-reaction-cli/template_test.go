@@ -0,0 +1,69 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRenderText(t *testing.T) {
+	rule := Rule{Name: "greet", re: regexp.MustCompile(`(?P<time>朝|夜)です`)}
+	n := note{ID: "note1", Text: "もう朝です。今日も一日がんばりましょう", User: noteUser{Username: "alice", Host: "example.com"}}
+
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{"投稿者", "@{{.User.Username}}@{{.User.Host}} おつかれさまです！", "@alice@example.com おつかれさまです！"},
+		{"キャプチャ", `{{.Captures.time}}ですね ({{index .Captures "0"}})`, "朝ですね (朝です)"},
+		{"ルール名", "{{.Rule}}", "greet"},
+		{"切り詰め", "{{.Text | truncate 5}}", "もう朝です…"},
+		{"短いテキストは切り詰めない", "{{truncate 100 .Text}}", n.Text},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := parseTextTemplate(tt.text)
+			if err != nil {
+				t.Fatalf("パースに失敗しました: %v", err)
+			}
+			got, err := rule.renderText(Action{tmpl: tmpl}, n)
+			if err != nil {
+				t.Fatalf("実行に失敗しました: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("期待値: %q, 実際: %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestPickLine(t *testing.T) {
+	defer func(intn func(int) int) { templateIntn = intn }(templateIntn)
+	templateIntn = func(n int) int { return n - 1 }
+
+	if got := pickLine("おはよう\n\nこんにちは\n"); got != "こんにちは" {
+		t.Errorf("空行を除いた最後の行を期待しましたが、実際: %q", got)
+	}
+	if got := pickLine(""); got != "" {
+		t.Errorf("空文字列を期待しましたが、実際: %q", got)
+	}
+}
+
+func TestParseTextTemplate_Error(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{"{{.Text", "テンプレートのパースに失敗しました"},
+		{"{{exec .Text}}", "テンプレートのパースに失敗しました"},
+		{"{{.Note.Text}}", "テンプレートが不正です"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if _, err := parseTextTemplate(tt.text); err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("エラー '%s' を期待しましたが、実際: %v", tt.expected, err)
+			}
+		})
+	}
+}
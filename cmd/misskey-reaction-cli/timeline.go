@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// defaultChannel は misskey.channel が省略されたときに購読するチャンネルです。
+const defaultChannel = "homeTimeline"
+
+// timelineEndpoints はストリーミングのチャンネルと、同じノートを返すREST APIのエンドポイントの対応です。
+var channelEndpoints = map[string]string{
+	"homeTimeline":   "notes/timeline",
+	"localTimeline":  "notes/local-timeline",
+	"hybridTimeline": "notes/hybrid-timeline",
+	"globalTimeline": "notes/global-timeline",
+}
+
+// ノートの受信方法
+const (
+	modeStream = "stream"
+	modePoll   = "poll"
+)
+
+// defaultPollInterval は poll_interval が省略されたときのポーリング間隔です。
+const defaultPollInterval = 30 * time.Second
+
+// timelinePageSize は1回のリクエストで取得するノート数です (Misskeyの上限は100)。
+const timelinePageSize = 100
+
+// channels returns the configured channels or the default channel.
+func (c MisskeyConfig) channels() []string {
+	switch {
+	case len(c.Channels) > 0:
+		return c.Channels
+	case c.Channel != "":
+		return []string{c.Channel}
+	default:
+		return []string{defaultChannel}
+	}
+}
+
+// timelineEndpoint returns the REST endpoint for the channel.
+func timelineEndpoint(channel string) (string, error) {
+	endpoint, ok := channelEndpoints[channel]
+	if !ok {
+		return "", fmt.Errorf("チャンネル %s に対応するタイムラインのエンドポイントがありません", channel)
+	}
+	return endpoint, nil
+}
+
+// timelineEndpoints returns the REST endpoints for the channels.
+func timelineEndpoints(channels []string) ([]string, error) {
+	endpoints := make([]string, len(channels))
+	for i, channel := range channels {
+		var err error
+		if endpoints[i], err = timelineEndpoint(channel); err != nil {
+			return nil, err
+		}
+	}
+	return endpoints, nil
+}
+
+// fetchTimeline fetches up to limit notes newer than sinceID from the
+// timeline endpoint, sorted from oldest to newest.
+func fetchTimeline(misskeyURL, endpoint, token, sinceID string, limit int) ([]note, error) {
+	body := map[string]interface{}{"limit": limit}
+	if sinceID != "" {
+		body["sinceId"] = sinceID
+	}
+	var notes []note
+	if err := callAPI(misskeyURL, endpoint, token, body, &notes); err != nil {
+		return nil, err
+	}
+	// エンドポイントやバージョンによって並び順が異なるため、古い順に揃える
+	sort.Slice(notes, func(i, j int) bool { return noteIDLess(notes[i].ID, notes[j].ID) })
+	return notes, nil
+}
+
+// noteIDLess reports whether note ID a is older than b. Misskey IDs of the
+// same scheme sort by creation time.
+func noteIDLess(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
+// pollNotes polls the timeline endpoint at the interval and calls the callback
+// for each new note, oldest first. Notes already on the timeline when polling
+// starts are skipped unless sinceID is given. It returns when a request fails,
+// or with nil once stop is closed. Each successful request is recorded in
+// state unless it is nil.
+func pollNotes(misskeyURL, endpoint, token, sinceID string, interval time.Duration, state *connState, stop <-chan struct{}, noteCallback func(n note)) error {
+	defer state.setDisconnected()
+	if sinceID == "" {
+		// 起動前のノートには反応しないよう、最新のノートIDだけを起点にする
+		notes, err := fetchTimeline(misskeyURL, endpoint, token, "", 1)
+		if err != nil {
+			return fmt.Errorf("タイムラインの取得に失敗しました: %w", err)
+		}
+		if len(notes) > 0 {
+			sinceID = notes[len(notes)-1].ID
+		}
+	}
+
+	// ポーリングでは取得できた時点で接続・購読済みとみなす
+	state.setConnected()
+	state.setSubscribed(time.Now())
+
+	for !stopped(stop) {
+		notes, err := fetchTimeline(misskeyURL, endpoint, token, sinceID, timelinePageSize)
+		if err != nil {
+			return fmt.Errorf("タイムラインの取得に失敗しました: %w", err)
+		}
+		state.setReceived(time.Now())
+		for _, n := range notes {
+			noteCallback(n)
+		}
+		if len(notes) > 0 {
+			sinceID = notes[len(notes)-1].ID
+		}
+		// 1ページに収まらなかった場合は待たずに続きを取得する
+		if len(notes) < timelinePageSize {
+			select {
+			case <-stop:
+			case <-time.After(interval):
+			}
+		}
+	}
+	return nil
+}
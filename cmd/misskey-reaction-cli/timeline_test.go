@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetchTimeline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/notes/local-timeline" {
+			t.Errorf("パス /api/notes/local-timeline を期待しましたが、%sが来ました", r.URL.Path)
+		}
+		var req map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req["sinceId"] != "9a" || req["limit"] != float64(100) {
+			t.Errorf("sinceId 9a, limit 100 を期待しましたが、実際: %v", req)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"id":"9c","text":"c"},{"id":"10a","text":"d"},{"id":"9b","text":"b"}]`))
+	}))
+	defer server.Close()
+
+	notes, err := fetchTimeline(server.URL, "notes/local-timeline", "testToken", "9a", 100)
+	if err != nil {
+		t.Fatalf("エラーが発生しないことを期待しましたが、発生しました: %v", err)
+	}
+	var ids []string
+	for _, n := range notes {
+		ids = append(ids, n.ID)
+	}
+	if expected := []string{"9b", "9c", "10a"}; !reflect.DeepEqual(ids, expected) {
+		t.Errorf("古い順の %v を期待しましたが、実際: %v", expected, ids)
+	}
+}
+
+func TestTimelineEndpoint(t *testing.T) {
+	tests := []struct {
+		channel   string
+		expected  string
+		expectErr bool
+	}{
+		{"homeTimeline", "notes/timeline", false},
+		{"localTimeline", "notes/local-timeline", false},
+		{"hybridTimeline", "notes/hybrid-timeline", false},
+		{"globalTimeline", "notes/global-timeline", false},
+		{"main", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.channel, func(t *testing.T) {
+			got, err := timelineEndpoint(tt.channel)
+			if got != tt.expected || (err != nil) != tt.expectErr {
+				t.Errorf("期待値: %s (エラー: %v), 実際: %s (%v)", tt.expected, tt.expectErr, got, err)
+			}
+		})
+	}
+}
+
+func TestPollNotes(t *testing.T) {
+	var requests []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&req)
+		requests = append(requests, req)
+		w.Header().Set("Content-Type", "application/json")
+		switch len(requests) {
+		case 1: // 起点となる最新のノート
+			w.Write([]byte(`[{"id":"9a","text":"old"}]`))
+		case 2:
+			w.Write([]byte(`[{"id":"9c","text":"c"},{"id":"9b","text":"b"}]`))
+		case 3:
+			w.Write([]byte(`[]`))
+		default:
+			writeAPIError(w, "INTERNAL_ERROR")
+		}
+	}))
+	defer server.Close()
+
+	var received []string
+	err := pollNotes(server.URL, "notes/timeline", "testToken", "", time.Millisecond, nil, nil, func(n note) {
+		received = append(received, n.ID)
+	})
+
+	if err == nil || !strings.Contains(err.Error(), "タイムラインの取得に失敗しました") {
+		t.Errorf("取得のエラーで終了することを期待しましたが、実際: %v", err)
+	}
+	if expected := []string{"9b", "9c"}; !reflect.DeepEqual(received, expected) {
+		t.Errorf("期待値: %v, 実際: %v", expected, received)
+	}
+	expectedSince := []interface{}{nil, "9a", "9c", "9c"}
+	for i, req := range requests {
+		if req["sinceId"] != expectedSince[i] {
+			t.Errorf("%d回目のリクエストのsinceId: 期待値 %v, 実際 %v", i+1, expectedSince[i], req["sinceId"])
+		}
+	}
+}
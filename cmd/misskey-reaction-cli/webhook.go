@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// defaultWebhookTimeout は webhook の timeout が省略されたときの値です。
+const defaultWebhookTimeout = 10 * time.Second
+
+// webhookSignatureHeader は secret を指定したときに署名を付けるヘッダーです。
+const webhookSignatureHeader = "X-Signature-256"
+
+// notePayload は webhook で送信し、exec の標準入力に渡すJSONです。
+type notePayload struct {
+	Rule        string   `json:"rule"`
+	MatchedText string   `json:"matched_text"`
+	NoteURL     string   `json:"note_url"`
+	Note        note     `json:"note"`
+	Author      noteUser `json:"author"`
+}
+
+// payload returns the payload describing the note matched by the rule.
+func (b *bot) payload(n note, rule *Rule) notePayload {
+	return notePayload{
+		Rule:        rule.Name,
+		MatchedText: rule.matchedText(n.Text),
+		NoteURL:     b.config.Misskey.URL + "/notes/" + n.ID,
+		Note:        n,
+		Author:      n.User,
+	}
+}
+
+// checkWebhook validates the webhook settings of the action.
+func checkWebhook(action Action) error {
+	u, err := url.Parse(action.URL)
+	if action.URL == "" || err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("webhook のurl %q は不正です (http:// または https:// で指定してください)", action.URL)
+	}
+	if action.Timeout < 0 {
+		return fmt.Errorf("webhook のtimeoutに負の値は指定できません")
+	}
+	return nil
+}
+
+// sendWebhook posts the payload to the action's URL. When a secret is set,
+// the hex HMAC-SHA256 of the body is sent as "sha256=<hex>" in the
+// X-Signature-256 header.
+func sendWebhook(action Action, payload notePayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	headers := make(map[string]string, len(action.Headers)+1)
+	for key, value := range action.Headers {
+		headers[key] = value
+	}
+	if action.Secret != "" {
+		headers[webhookSignatureHeader] = "sha256=" + signWebhook(action.Secret, body)
+	}
+	timeout := action.Timeout
+	if timeout == 0 {
+		timeout = defaultWebhookTimeout
+	}
+
+	status, respBody, err := postJSON(&http.Client{Timeout: timeout}, action.URL, headers, body)
+	if err != nil {
+		// url.Error はURL全体を含むため、トークンがログに残らないよう取り除く
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return fmt.Errorf("Webhook (%s) への送信に失敗しました: %w", webhookHost(action.URL), urlErr.Err)
+		}
+		return err
+	}
+	if status < 200 || status >= 300 {
+		// 再試行の判定をMisskey APIと揃えるため apiError として返す
+		return &apiError{Message: truncate(200, strings.TrimSpace(string(respBody))), Status: status}
+	}
+	return nil
+}
+
+// signWebhook returns the hex-encoded HMAC-SHA256 of body.
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookHost returns the host of the webhook URL for logging, so that
+// tokens in the path or query are not written to the log.
+func webhookHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
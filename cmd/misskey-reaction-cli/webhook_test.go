@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSendWebhook(t *testing.T) {
+	var received notePayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if got := r.Header.Get("X-Token"); got != "abc" {
+			t.Errorf("ヘッダー X-Token: abc を期待しましたが、実際: %q", got)
+		}
+		if got, expected := r.Header.Get(webhookSignatureHeader), "sha256="+signWebhook("secret", body); got != expected {
+			t.Errorf("署名 %s を期待しましたが、実際: %s", expected, got)
+		}
+		json.Unmarshal(body, &received)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	action := Action{Type: actionWebhook, URL: server.URL, Headers: map[string]string{"X-Token": "abc"}, Secret: "secret"}
+	payload := notePayload{Rule: "r", MatchedText: "hello", Note: note{ID: "note1", Text: "hello"}, Author: noteUser{Username: "alice"}}
+	if err := sendWebhook(action, payload); err != nil {
+		t.Fatalf("エラーが発生しないことを期待しましたが、発生しました: %v", err)
+	}
+	if received.Rule != "r" || received.MatchedText != "hello" || received.Note.ID != "note1" || received.Author.Username != "alice" {
+		t.Errorf("送信したペイロードと一致しません: %+v", received)
+	}
+}
+
+func TestSendWebhook_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(100 * time.Millisecond)
+		}
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("forbidden\n"))
+	}))
+	defer server.Close()
+
+	err := sendWebhook(Action{URL: server.URL}, notePayload{})
+	if err == nil || isTemporary(err) || !strings.Contains(err.Error(), "forbidden (Status: 403)") {
+		t.Errorf("再試行しない403のエラーを期待しましたが、実際: %v", err)
+	}
+
+	err = sendWebhook(Action{URL: server.URL + "/slow?token=xyz", Timeout: 10 * time.Millisecond}, notePayload{})
+	if err == nil || !isTemporary(err) {
+		t.Errorf("再試行するタイムアウトのエラーを期待しましたが、実際: %v", err)
+	}
+	if strings.Contains(err.Error(), "xyz") {
+		t.Errorf("エラーにWebhookのクエリが含まれないことを期待しましたが、実際: %v", err)
+	}
+}
+
+func TestCheckWebhook(t *testing.T) {
+	tests := []struct {
+		action    Action
+		expectErr bool
+	}{
+		{Action{URL: "https://example.com/hook"}, false},
+		{Action{URL: ""}, true},
+		{Action{URL: "ftp://example.com"}, true},
+		{Action{URL: "example.com/hook"}, true},
+		{Action{URL: "https://example.com", Timeout: -time.Second}, true},
+	}
+	for _, tt := range tests {
+		if err := checkWebhook(tt.action); (err != nil) != tt.expectErr {
+			t.Errorf("%+v: エラーの有無の期待値: %v, 実際: %v", tt.action, tt.expectErr, err)
+		}
+	}
+}
+
+func TestBotHandleNote_Webhook(t *testing.T) {
+	var mu sync.Mutex
+	var payloads []notePayload
+	failures := 1
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var p notePayload
+		json.NewDecoder(r.Body).Decode(&p)
+		payloads = append(payloads, p)
+	}))
+	defer hook.Close()
+
+	server := newMockMisskey(t, `{"emojis":[]}`)
+	config := testConfig(server.URL, Rule{
+		Name:      "alert",
+		MatchText: `障害\S*`,
+		MatchType: "regex",
+		Actions:   []Action{{Type: actionWebhook, URL: hook.URL + "/hook?token=xyz"}},
+	})
+	config.Retry = RetryConfig{MaxAttempts: 2, Interval: time.Millisecond}
+	b, logBuffer := newTestBot(t, config)
+
+	b.handleNote(note{ID: "note1", Text: "サーバー障害発生中", User: noteUser{ID: "u1", Username: "alice"}})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(payloads) != 1 {
+		t.Fatalf("再試行して1件送信することを期待しましたが、実際: %+v", payloads)
+	}
+	p := payloads[0]
+	if p.Rule != "alert" || p.MatchedText != "障害発生中" || p.NoteURL != server.URL+"/notes/note1" || p.Author.Username != "alice" {
+		t.Errorf("ペイロードが期待と異なります: %+v", p)
+	}
+	if strings.Contains(logBuffer.String(), "xyz") {
+		t.Errorf("ログにWebhookのクエリが含まれないことを期待しました: %s", logBuffer.String())
+	}
+}
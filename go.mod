@@ -3,6 +3,8 @@ module misskey-reaction-cli
 go 1.22.2
 
 require (
-	github.com/gorilla/websocket v1.5.3 // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
+	github.com/gorilla/websocket v1.5.3
+	gopkg.in/yaml.v2 v2.4.0
 )
+
+require golang.org/x/text v0.22.0
@@ -0,0 +1,133 @@
+// Package audit records every decision the bot makes about a note as one
+// JSON object per line, and reads such logs back.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"misskey-reaction-cli/internal/logrotate"
+)
+
+// Record の Event
+const (
+	// EventReceived はノートを受信したこと
+	EventReceived = "received"
+	// EventRule はルールを評価した結果
+	EventRule = "rule"
+	// EventSkip はノートへのアクションをやめたこと。理由は Reason
+	EventSkip = "skip"
+	// EventAction はアクションのAPI呼び出しの結果
+	EventAction = "action"
+)
+
+// EventRule の Result
+const (
+	ResultMatch   = "match"
+	ResultNoMatch = "no_match"
+	// ResultInactive はルールに一致したが、有効な時間帯ではなかったこと
+	ResultInactive = "inactive"
+)
+
+// EventAction の Result
+const (
+	ResultOK    = "ok"
+	ResultError = "error"
+	// ResultSkipped は既にリアクション済みなどの理由で実行しなかったこと
+	ResultSkipped = "skipped"
+	ResultDryRun  = "dry_run"
+)
+
+// Record は監査ログの1行です。イベントに関係のない項目は省略される
+type Record struct {
+	Time    time.Time `json:"time"`
+	Account string    `json:"account,omitempty"`
+	Event   string    `json:"event"`
+	NoteID  string    `json:"note_id"`
+	Channel string    `json:"channel,omitempty"`
+	// NoteAge は判断した時点でのノートの投稿からの経過時間 (投稿日時が分からない場合は省略)
+	NoteAge string `json:"note_age,omitempty"`
+	UserID  string `json:"user_id,omitempty"`
+	Rule    string `json:"rule,omitempty"`
+	Result  string `json:"result,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+	Action  string `json:"action,omitempty"`
+	Emoji   string `json:"emoji,omitempty"`
+	// Detail は頻度制限の理由やエラーメッセージなどの補足
+	Detail    string `json:"detail,omitempty"`
+	ErrorCode string `json:"error_code,omitempty"`
+}
+
+// Log appends records to a writer. A nil *Log discards every record, so that
+// callers do not have to check whether auditing is enabled. It is safe for
+// concurrent use.
+type Log struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+// New returns a log that writes to w.
+func New(w io.Writer) *Log {
+	return &Log{w: w}
+}
+
+// Open opens the file at path for appending, rotating it with opts.
+func Open(path string, opts logrotate.Options) (*Log, error) {
+	w, err := logrotate.Open(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Log{w: w, closer: w}, nil
+}
+
+// Write appends the record as one line.
+func (l *Log) Write(r Record) error {
+	if l == nil {
+		return nil
+	}
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	// ローテートで行が分かれないよう、改行まで1回で書き込む
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.w.Write(line)
+	return err
+}
+
+// Close closes the underlying file, if any.
+func (l *Log) Close() error {
+	if l == nil || l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
+
+// Read parses every record of an audit log.
+func Read(r io.Reader) ([]Record, error) {
+	var records []Record
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("監査ログの %d 行目を読み込めません: %w", line, err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("監査ログの読み込みに失敗しました: %w", err)
+	}
+	return records, nil
+}
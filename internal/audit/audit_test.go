@@ -0,0 +1,81 @@
+package audit
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"misskey-reaction-cli/internal/logrotate"
+)
+
+func TestWriteRead(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	records := []Record{
+		{Time: now, Event: EventReceived, NoteID: "note1", Channel: "homeTimeline", UserID: "user1"},
+		{Time: now, Event: EventRule, NoteID: "note1", Rule: "greet", Result: ResultMatch},
+		{Time: now, Account: "main", Event: EventAction, NoteID: "note1", Rule: "greet", Action: "reaction", Emoji: "🎉", Result: ResultError, Detail: "API error", ErrorCode: "RATE_LIMIT_EXCEEDED"},
+	}
+
+	var buf bytes.Buffer
+	log := New(&buf)
+	for _, r := range records {
+		if err := log.Write(r); err != nil {
+			t.Fatalf("書き込みに失敗しました: %v", err)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 3 || lines[1] != `{"time":"2024-01-01T12:00:00Z","event":"rule","note_id":"note1","rule":"greet","result":"match"}` {
+		t.Errorf("1レコード1行で、空の項目は省略することを期待しましたが、実際: %s", buf.String())
+	}
+	got, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("読み込みに失敗しました: %v", err)
+	}
+	if !reflect.DeepEqual(got, records) {
+		t.Errorf("期待値: %+v, 実際: %+v", records, got)
+	}
+}
+
+func TestRead_Invalid(t *testing.T) {
+	_, err := Read(strings.NewReader(`{"event":"received","note_id":"note1"}` + "\n\n{broken\n"))
+	if err == nil || !strings.Contains(err.Error(), "監査ログの 3 行目を読み込めません") {
+		t.Errorf("3行目のエラーを期待しましたが、実際: %v", err)
+	}
+}
+
+func TestOpen_Append(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	for _, id := range []string{"note1", "note2"} {
+		log, err := Open(path, logrotate.Options{})
+		if err != nil {
+			t.Fatalf("監査ログを開けませんでした: %v", err)
+		}
+		log.Write(Record{Event: EventReceived, NoteID: id})
+		log.Close()
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	records, err := Read(file)
+	if err != nil || len(records) != 2 || records[0].NoteID != "note1" || records[1].NoteID != "note2" {
+		t.Errorf("開き直しても追記することを期待しましたが、実際: %+v, %v", records, err)
+	}
+}
+
+func TestNilLog(t *testing.T) {
+	var log *Log
+	if err := log.Write(Record{Event: EventReceived}); err != nil {
+		t.Errorf("nilのログへの書き込みは無視することを期待しましたが、実際: %v", err)
+	}
+	if err := log.Close(); err != nil {
+		t.Errorf("nilのログのCloseは無視することを期待しましたが、実際: %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+// Package emoji recognizes Unicode emoji and Misskey custom emoji codes in
+// text.
+//
+// Unicode emoji are detected with a compact approximation of the
+// Extended_Pictographic property rather than the full emoji data tables,
+// which is sufficient to tell an emoji from ordinary text.
+package emoji
+
+import (
+	"regexp"
+	"unicode/utf8"
+)
+
+// カスタム絵文字 (:name: / :name@host: / :name@.:)
+var customCode = regexp.MustCompile(`^:([a-zA-Z0-9_+\-]+)(?:@([a-zA-Z0-9_.\-]+))?:`)
+
+const (
+	zwj            = 0x200D
+	keycap         = 0x20E3
+	variationText  = 0xFE0E
+	variationEmoji = 0xFE0F
+	skinToneFirst  = 0x1F3FB
+	skinToneLast   = 0x1F3FF
+	regionalFirst  = 0x1F1E6
+	regionalLast   = 0x1F1FF
+	tagFirst       = 0xE0020
+	tagLast        = 0xE007F
+)
+
+// 絵文字として扱うコードポイントの範囲
+var pictographicRanges = [][2]rune{
+	{0x00A9, 0x00A9}, {0x00AE, 0x00AE}, {0x203C, 0x203C}, {0x2049, 0x2049},
+	{0x2122, 0x2122}, {0x2139, 0x2139}, {0x2194, 0x2199}, {0x21A9, 0x21AA},
+	{0x231A, 0x231B}, {0x2328, 0x2328}, {0x23CF, 0x23CF}, {0x23E9, 0x23F3},
+	{0x23F8, 0x23FA}, {0x24C2, 0x24C2}, {0x25AA, 0x25AB}, {0x25B6, 0x25B6},
+	{0x25C0, 0x25C0}, {0x25FB, 0x25FE}, {0x2600, 0x27BF}, {0x2934, 0x2935},
+	{0x2B05, 0x2B07}, {0x2B1B, 0x2B1C}, {0x2B50, 0x2B50}, {0x2B55, 0x2B55},
+	{0x3030, 0x3030}, {0x303D, 0x303D}, {0x3297, 0x3297}, {0x3299, 0x3299},
+	{0x1F000, 0x1F1E5}, {0x1F200, 0x1F3FA}, {0x1F400, 0x1FAFF},
+}
+
+func isPictographic(r rune) bool {
+	for _, rg := range pictographicRanges {
+		if rg[0] <= r && r <= rg[1] {
+			return true
+		}
+	}
+	return false
+}
+
+func isRegional(r rune) bool { return regionalFirst <= r && r <= regionalLast }
+
+// IsUnicode reports whether s consists of exactly one Unicode emoji,
+// including ZWJ sequences, flags, keycaps and skin tone variants.
+func IsUnicode(s string) bool {
+	n := unicodeLen(s)
+	return n > 0 && n == len(s)
+}
+
+// IsCustom reports whether s is a custom emoji code such as ":name:",
+// ":name@.:" or ":name@host:".
+func IsCustom(s string) bool {
+	m := customCode.FindString(s)
+	return m != "" && len(m) == len(s)
+}
+
+// ParseCustom splits a custom emoji code into its name and host. The host is
+// empty for ":name:", "." for ":name@.:" (the local instance written
+// explicitly) and the remote host otherwise.
+func ParseCustom(s string) (name, host string, ok bool) {
+	m := customCode.FindStringSubmatch(s)
+	if m == nil || len(m[0]) != len(s) {
+		return "", "", false
+	}
+	return m[1], m[2], true
+}
+
+// CustomPrefix returns the custom emoji code at the head of s, or an empty
+// string if s does not start with one.
+func CustomPrefix(s string) string {
+	return customCode.FindString(s)
+}
+
+// First returns the first Unicode emoji or custom emoji code in text, or an
+// empty string if there is none.
+func First(text string) string {
+	for i := 0; i < len(text); {
+		if text[i] == ':' && (i == 0 || !isAlnum(text[i-1])) {
+			if m := CustomPrefix(text[i:]); m != "" {
+				return m
+			}
+		}
+		if n := unicodeLen(text[i:]); n > 0 {
+			return text[i : i+n]
+		}
+		_, size := utf8.DecodeRuneInString(text[i:])
+		i += size
+	}
+	return ""
+}
+
+// unicodeLen returns the byte length of the Unicode emoji at the head of s,
+// or 0 if s does not start with one.
+func unicodeLen(s string) int {
+	r, size := utf8.DecodeRuneInString(s)
+	switch {
+	case r == '#' || r == '*' || '0' <= r && r <= '9':
+		// キーキャップ (例: 1️⃣)
+		n := size
+		if next, sz := utf8.DecodeRuneInString(s[n:]); next == variationEmoji {
+			n += sz
+		}
+		if next, sz := utf8.DecodeRuneInString(s[n:]); next == keycap {
+			return n + sz
+		}
+		return 0
+	case isRegional(r):
+		// 国旗は地域指示子2つで1つの絵文字になる
+		if next, sz := utf8.DecodeRuneInString(s[size:]); isRegional(next) {
+			return size + sz
+		}
+		return 0
+	case !isPictographic(r):
+		return 0
+	}
+
+	n := size
+	for n < len(s) {
+		next, sz := utf8.DecodeRuneInString(s[n:])
+		switch {
+		case next == variationEmoji, next == variationText, next == keycap,
+			skinToneFirst <= next && next <= skinToneLast,
+			tagFirst <= next && next <= tagLast:
+			n += sz
+		case next == zwj:
+			joined, jsz := utf8.DecodeRuneInString(s[n+sz:])
+			if !isPictographic(joined) {
+				return n
+			}
+			n += sz + jsz
+		default:
+			return n
+		}
+	}
+	return n
+}
+
+func isAlnum(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
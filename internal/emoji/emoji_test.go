@@ -0,0 +1,103 @@
+package emoji
+
+import "testing"
+
+func TestIsUnicode(t *testing.T) {
+	tests := []struct {
+		name     string
+		s        string
+		expected bool
+	}{
+		{"基本", "🍣", true},
+		{"異体字セレクタ付き", "❤️", true},
+		{"肌の色", "👍🏽", true},
+		{"ZWJシーケンス", "👨‍👩‍👧", true},
+		{"国旗", "🇯🇵", true},
+		{"キーキャップ", "1️⃣", true},
+		{"文字", "a", false},
+		{"数字だけ", "1", false},
+		{"ひらがな", "あ", false},
+		{"絵文字2つ", "🍣🍺", false},
+		{"絵文字と文字", "🍣です", false},
+		{"地域指示子1つ", "🇯", false},
+		{"空", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsUnicode(tt.s); got != tt.expected {
+				t.Errorf("期待値: %v, 実際: %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseCustom(t *testing.T) {
+	tests := []struct {
+		s          string
+		name, host string
+		ok         bool
+	}{
+		{":awesome:", "awesome", "", true},
+		{":blob_cat+1:", "blob_cat+1", "", true},
+		{":awesome@.:", "awesome", ".", true},
+		{":awesome@misskey.io:", "awesome", "misskey.io", true},
+		{"awesome", "", "", false},
+		{":awe some:", "", "", false},
+		{":awesome: ", "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			name, host, ok := ParseCustom(tt.s)
+			if name != tt.name || host != tt.host || ok != tt.ok {
+				t.Errorf("期待値: (%q, %q, %v), 実際: (%q, %q, %v)", tt.name, tt.host, tt.ok, name, host, ok)
+			}
+			if IsCustom(tt.s) != tt.ok {
+				t.Errorf("IsCustom: 期待値: %v", tt.ok)
+			}
+		})
+	}
+}
+
+func TestCustomPrefix(t *testing.T) {
+	tests := []struct {
+		s        string
+		expected string
+	}{
+		{":awesome: です", ":awesome:"},
+		{":awesome@misskey.io::blob:", ":awesome@misskey.io:"},
+		{"a :awesome:", ""},
+		{":awe some:", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			if got := CustomPrefix(tt.s); got != tt.expected {
+				t.Errorf("期待値: %q, 実際: %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestFirst(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{"Unicode絵文字", "今日の気分: 🍣", "🍣"},
+		{"ZWJシーケンス", "家族 👨‍👩‍👧 です", "👨‍👩‍👧"},
+		{"カスタム絵文字が先", "今日の気分: :sushi: 🍣", ":sushi:"},
+		{"Unicode絵文字が先", "🍣 :sushi:", "🍣"},
+		{"時刻は絵文字ではない", "12:30:00 に 🍺", "🍺"},
+		{"絵文字なし", "今日の気分: 普通", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := First(tt.text); got != tt.expected {
+				t.Errorf("期待値: %q, 実際: %q", tt.expected, got)
+			}
+		})
+	}
+}
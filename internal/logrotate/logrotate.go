@@ -0,0 +1,325 @@
+// Package logrotate provides a log file writer that rotates the file by size
+// and age, keeps a limited number of old files and optionally compresses
+// them.
+package logrotate
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat はローテートしたファイル名に付ける時刻の形式
+const backupTimeFormat = "20060102-150405"
+
+// Options configures when to rotate and how many old files to keep. The zero
+// value never rotates.
+type Options struct {
+	// MaxSizeMB はローテートするファイルの大きさ (MB)。0の場合は大きさでローテートしない
+	MaxSizeMB int `yaml:"max_size_mb"`
+	// MaxAge はファイルを作成してからローテートするまでの時間 (例: 24h)。0の場合は時間でローテートしない
+	MaxAge time.Duration `yaml:"max_age"`
+	// MaxBackups は残す古いファイルの数。0の場合はすべて残す
+	MaxBackups int `yaml:"max_backups"`
+	// Compress は古いファイルをgzipで圧縮するかどうか
+	Compress bool `yaml:"compress"`
+}
+
+// Writer is an io.Writer that appends to a log file and rotates it according
+// to its options. It is safe for concurrent use.
+type Writer struct {
+	path string
+	opts Options
+	now  func() time.Time
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+	// createdAt は開いているファイルを作成した時刻。再起動や開き直しでは変わらない
+	createdAt time.Time
+	// compressErr はバックグラウンドの圧縮や古いファイルの削除で起きたエラー。次の書き込みで返す
+	compressErr error
+
+	// compressing はバックグラウンドの圧縮を1つずつ行うためのロック
+	compressing sync.Mutex
+	wg          sync.WaitGroup
+}
+
+// Open opens the log file at path for appending, creating it if needed.
+func Open(path string, opts Options) (*Writer, error) {
+	if opts.MaxSizeMB < 0 || opts.MaxAge < 0 || opts.MaxBackups < 0 {
+		return nil, errors.New("log_rotate の max_size_mb, max_age, max_backups に負の値は指定できません")
+	}
+	w := &Writer{path: path, opts: opts, now: time.Now}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// open opens the file and records its current size. The caller must hold mu
+// or have exclusive access to w.
+func (w *Writer) open() error {
+	file, err := os.OpenFile(w.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	w.file = file
+	w.size = info.Size()
+	w.createdAt = w.created(info)
+	return nil
+}
+
+// created estimates when the open file was created, since the creation time
+// is not portably available. A new file was created now. For an existing
+// file it is the time of the latest rotation, which created the file, or
+// otherwise its modification time.
+func (w *Writer) created(info os.FileInfo) time.Time {
+	if info.Size() == 0 {
+		return w.now()
+	}
+	if names, err := w.backups(); err == nil && len(names) > 0 {
+		latest := strings.TrimPrefix(filepath.Base(names[len(names)-1]), filepath.Base(w.path)+".")
+		if t, err := time.ParseInLocation(backupTimeFormat, latest[:len(backupTimeFormat)], w.now().Location()); err == nil {
+			return t
+		}
+	}
+	return info.ModTime()
+}
+
+// Write appends p to the file, rotating it first when p would make it larger
+// than the maximum size or when it has been open longer than the maximum age.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+	rotateErr := w.compressErr
+	w.compressErr = nil
+	if w.shouldRotate(int64(len(p))) {
+		rotateErr = errors.Join(rotateErr, w.rotate())
+		// 古いファイルの削除に失敗しても、開いているファイルには書き込む
+		if w.file == nil {
+			return 0, rotateErr
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, errors.Join(err, rotateErr)
+}
+
+// shouldRotate reports whether the file must be rotated before writing n
+// bytes. 空のファイルは大きさに関わらずローテートしない
+func (w *Writer) shouldRotate(n int64) bool {
+	if w.size == 0 {
+		return false
+	}
+	if w.opts.MaxSizeMB > 0 && w.size+n > int64(w.opts.MaxSizeMB)*1024*1024 {
+		return true
+	}
+	return w.opts.MaxAge > 0 && w.now().Sub(w.createdAt) >= w.opts.MaxAge
+}
+
+// Rotate renames the current file with a timestamp and opens a new one.
+func (w *Writer) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return os.ErrClosed
+	}
+	return w.rotate()
+}
+
+// rotate renames the current file, opens a new one and removes the oldest
+// backups. When compression is configured, the renamed file is compressed
+// and the backups are removed in the background, so that writes do not wait
+// for it. The caller must hold mu.
+func (w *Writer) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	w.file = nil
+
+	backup := w.backupName()
+	if err := os.Rename(w.path, backup); err != nil {
+		// 退避できなくても書き込みは続けられるよう、元のファイルを開き直す
+		if openErr := w.open(); openErr != nil {
+			return errors.Join(err, openErr)
+		}
+		return fmt.Errorf("ログファイルのローテートに失敗しました: %w", err)
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+
+	if w.opts.Compress {
+		w.wg.Add(1)
+		go w.compressBackups()
+		return nil
+	}
+	return w.removeOldBackups()
+}
+
+// compressBackups compresses the rotated files that are not compressed yet,
+// oldest first, and removes the oldest backups. The error is returned by the
+// next Write.
+func (w *Writer) compressBackups() {
+	defer w.wg.Done()
+	w.compressing.Lock()
+	defer w.compressing.Unlock()
+
+	names, err := w.backups()
+	for _, name := range names {
+		if strings.HasSuffix(name, ".gz") {
+			continue
+		}
+		if compressErr := compress(name); compressErr != nil {
+			err = errors.Join(err, fmt.Errorf("ログファイルの圧縮に失敗しました: %w", compressErr))
+		}
+	}
+	err = errors.Join(err, w.removeOldBackups())
+	if err != nil {
+		w.mu.Lock()
+		w.compressErr = errors.Join(w.compressErr, err)
+		w.mu.Unlock()
+	}
+}
+
+// backupName returns an unused name for the rotated file, such as
+// app.log.20240101-120000.
+func (w *Writer) backupName() string {
+	base := w.path + "." + w.now().Format(backupTimeFormat)
+	name := base
+	for i := 1; exists(name) || exists(name+".gz"); i++ {
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+	return name
+}
+
+// backups returns the rotated files of the log, oldest first.
+func (w *Writer) backups() ([]string, error) {
+	dir, prefix := filepath.Dir(w.path), filepath.Base(w.path)+"."
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		// ローテートしたファイル以外は対象にしない
+		suffix := strings.TrimPrefix(name, prefix)
+		if len(suffix) < len(backupTimeFormat) {
+			continue
+		}
+		if _, err := time.Parse(backupTimeFormat, suffix[:len(backupTimeFormat)]); err != nil {
+			continue
+		}
+		names = append(names, filepath.Join(dir, name))
+	}
+	// 時刻の形式が固定長のため、圧縮の有無を除いた名前順が古い順になる
+	sort.Slice(names, func(i, j int) bool {
+		return strings.TrimSuffix(names[i], ".gz") < strings.TrimSuffix(names[j], ".gz")
+	})
+	return names, nil
+}
+
+// removeOldBackups removes the oldest rotated files beyond MaxBackups.
+func (w *Writer) removeOldBackups() error {
+	if w.opts.MaxBackups == 0 {
+		return nil
+	}
+	names, err := w.backups()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for len(names) > w.opts.MaxBackups {
+		if err := os.Remove(names[0]); err != nil {
+			errs = append(errs, err)
+		}
+		names = names[1:]
+	}
+	return errors.Join(errs...)
+}
+
+// Reopen closes and reopens the file at the same path. It is used after an
+// external tool such as logrotate has moved the file.
+func (w *Writer) Reopen() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file != nil {
+		if err := w.file.Close(); err != nil {
+			return err
+		}
+		w.file = nil
+	}
+	return w.open()
+}
+
+// Close closes the file and waits for the compression of rotated files.
+// Further writes fail.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	var err error
+	if w.file != nil {
+		err = w.file.Close()
+		w.file = nil
+	}
+	w.mu.Unlock()
+
+	w.wg.Wait()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	err = errors.Join(err, w.compressErr)
+	w.compressErr = nil
+	return err
+}
+
+// compress replaces the file at path with a gzip-compressed path.gz.
+func compress(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if closeErr := zw.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+	return os.Remove(path)
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
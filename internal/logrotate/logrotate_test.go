@@ -0,0 +1,192 @@
+package logrotate
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestWriter は時刻を固定したWriterを作成します。
+func newTestWriter(t *testing.T, opts Options) (*Writer, string, *time.Time) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "app.log")
+	w, err := Open(path, opts)
+	if err != nil {
+		t.Fatalf("ログファイルを開けませんでした: %v", err)
+	}
+	t.Cleanup(func() { w.Close() })
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	w.now = func() time.Time { return now }
+	w.createdAt = now
+	return w, path, &now
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%s を読み込めませんでした: %v", path, err)
+	}
+	return string(data)
+}
+
+func TestWriter_MaxSize(t *testing.T) {
+	w, path, now := newTestWriter(t, Options{MaxSizeMB: 1})
+	line := strings.Repeat("a", 600*1024)
+
+	w.Write([]byte(line))
+	*now = now.Add(time.Second)
+	w.Write([]byte(line)) // 1MBを超えるため、書き込む前にローテートする
+
+	if got := readFile(t, path); got != line {
+		t.Errorf("新しいファイルには2回目の書き込みだけを期待しましたが、実際の大きさ: %d", len(got))
+	}
+	if got := readFile(t, path+".20240101-120001"); got != line {
+		t.Errorf("ローテートしたファイルには1回目の書き込みを期待しましたが、実際の大きさ: %d", len(got))
+	}
+}
+
+func TestWriter_MaxAge(t *testing.T) {
+	w, path, now := newTestWriter(t, Options{MaxAge: time.Hour})
+
+	w.Write([]byte("first\n"))
+	*now = now.Add(30 * time.Minute)
+	w.Write([]byte("second\n"))
+	*now = now.Add(30 * time.Minute)
+	w.Write([]byte("third\n"))
+
+	if got := readFile(t, path); got != "third\n" {
+		t.Errorf("期待値: %q, 実際: %q", "third\n", got)
+	}
+	if got := readFile(t, path+".20240101-130000"); got != "first\nsecond\n" {
+		t.Errorf("期待値: %q, 実際: %q", "first\nsecond\n", got)
+	}
+}
+
+func TestWriter_MaxBackupsAndCompress(t *testing.T) {
+	w, path, now := newTestWriter(t, Options{MaxBackups: 2, Compress: true})
+	os.WriteFile(path+".unrelated", []byte("x"), 0644)
+
+	for i := 0; i < 4; i++ {
+		w.Write([]byte{byte('0' + i), '\n'})
+		if err := w.Rotate(); err != nil {
+			t.Fatalf("ローテートに失敗しました: %v", err)
+		}
+		*now = now.Add(time.Minute)
+	}
+	// 圧縮はバックグラウンドで行われるため、閉じて完了を待つ
+	if err := w.Close(); err != nil {
+		t.Fatalf("閉じる際にエラーが発生しました: %v", err)
+	}
+
+	names, err := w.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{path + ".20240101-120200.gz", path + ".20240101-120300.gz"}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Fatalf("期待値: %v, 実際: %v", expected, names)
+	}
+	if _, err := os.Stat(path + ".unrelated"); err != nil {
+		t.Errorf("ローテートしたファイル以外は削除しないことを期待しました: %v", err)
+	}
+
+	f, err := os.Open(names[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("gzipとして読み込めませんでした: %v", err)
+	}
+	if data, _ := io.ReadAll(zr); string(data) != "3\n" {
+		t.Errorf("期待値: %q, 実際: %q", "3\n", data)
+	}
+}
+
+func TestWriter_MaxAgeAcrossRestart(t *testing.T) {
+	now := time.Date(2024, 1, 2, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		name     string
+		setup    func(path string)
+		expected time.Time
+	}{
+		{"新しいファイル", func(path string) {}, now},
+		{"前回ローテートしたファイル", func(path string) {
+			os.WriteFile(path+".20240101-090000.gz", nil, 0644)
+			os.WriteFile(path+".20240102-060000", nil, 0644)
+			os.WriteFile(path, []byte("old\n"), 0644)
+		}, time.Date(2024, 1, 2, 6, 0, 0, 0, time.Local)},
+		{"ローテートしていないファイル", func(path string) {
+			os.WriteFile(path, []byte("old\n"), 0644)
+			os.Chtimes(path, now, now.Add(-3*time.Hour))
+		}, now.Add(-3 * time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "app.log")
+			tt.setup(path)
+			w := &Writer{path: path, opts: Options{MaxAge: 6 * time.Hour}, now: func() time.Time { return now }}
+			if err := w.open(); err != nil {
+				t.Fatal(err)
+			}
+			defer w.Close()
+
+			// 再起動で開き直しても、ファイルを作成した時刻から数える
+			if !w.createdAt.Equal(tt.expected) {
+				t.Errorf("期待値: %v, 実際: %v", tt.expected, w.createdAt)
+			}
+			if rotate := w.shouldRotate(1); rotate != (now.Sub(tt.expected) >= 6*time.Hour) {
+				t.Errorf("ローテートの判定が誤っています: %v", rotate)
+			}
+		})
+	}
+}
+
+func TestWriter_SameSecond(t *testing.T) {
+	w, path, _ := newTestWriter(t, Options{})
+
+	for i := 0; i < 2; i++ {
+		w.Write([]byte("x\n"))
+		w.Rotate()
+	}
+
+	for _, name := range []string{path + ".20240101-120000", path + ".20240101-120000-1"} {
+		if _, err := os.Stat(name); err != nil {
+			t.Errorf("%s が存在することを期待しました: %v", name, err)
+		}
+	}
+}
+
+func TestWriter_Reopen(t *testing.T) {
+	w, path, _ := newTestWriter(t, Options{})
+
+	w.Write([]byte("before\n"))
+	// 外部のlogrotateがファイルを移動した状態
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("moved\n"))
+	if err := w.Reopen(); err != nil {
+		t.Fatalf("開き直しに失敗しました: %v", err)
+	}
+	w.Write([]byte("after\n"))
+
+	if got := readFile(t, path+".1"); got != "before\nmoved\n" {
+		t.Errorf("期待値: %q, 実際: %q", "before\nmoved\n", got)
+	}
+	if got := readFile(t, path); got != "after\n" {
+		t.Errorf("期待値: %q, 実際: %q", "after\n", got)
+	}
+}
+
+func TestOpen_Invalid(t *testing.T) {
+	if _, err := Open(filepath.Join(t.TempDir(), "app.log"), Options{MaxBackups: -1}); err == nil || !strings.Contains(err.Error(), "負の値は指定できません") {
+		t.Errorf("負の値のエラーを期待しましたが、実際: %v", err)
+	}
+}
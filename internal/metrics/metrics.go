@@ -0,0 +1,335 @@
+// Package metrics implements counters, gauges and histograms with labels and
+// writes them in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets はHTTPリクエストの所要時間 (秒) 向けのヒストグラムのバケットです。
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Registry holds metric families and writes them in registration order.
+type Registry struct {
+	mu       sync.Mutex
+	families []family
+}
+
+// family はメトリクスの種類ごとの書き出し処理です。
+type family interface {
+	write(w *bufio.Writer)
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(f family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.families = append(r.families, f)
+}
+
+// WriteTo writes every metric in the Prometheus text format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	families := append([]family(nil), r.families...)
+	r.mu.Unlock()
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, f := range families {
+		f.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// Handler returns an HTTP handler that serves the metrics.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteTo(w)
+	})
+}
+
+// vec はラベルの値の組ごとの系列を保持します。
+type vec[T any] struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*entry[T]
+	newT   func() T
+}
+
+type entry[T any] struct {
+	values []string
+	value  T
+}
+
+func newVec[T any](name, help, kind string, labels []string, newT func() T) *vec[T] {
+	return &vec[T]{name: name, help: help, kind: kind, labels: labels, series: make(map[string]*entry[T]), newT: newT}
+}
+
+// with returns the series for the label values, creating it if needed. The
+// caller must hold mu.
+func (v *vec[T]) with(values []string) *entry[T] {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s のラベルの数は %d ですが、%d 個の値が指定されました", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	e, ok := v.series[key]
+	if !ok {
+		e = &entry[T]{values: append([]string(nil), values...), value: v.newT()}
+		v.series[key] = e
+	}
+	return e
+}
+
+// lookup returns the series for the label values without creating it. The
+// caller must hold mu.
+func (v *vec[T]) lookup(values []string) (*entry[T], bool) {
+	e, ok := v.series[strings.Join(values, "\xff")]
+	return e, ok
+}
+
+// sorted returns the series ordered by their label values. The caller must
+// hold mu.
+func (v *vec[T]) sorted() []*entry[T] {
+	entries := make([]*entry[T], 0, len(v.series))
+	for _, e := range v.series {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return strings.Join(entries[i].values, "\xff") < strings.Join(entries[j].values, "\xff")
+	})
+	return entries
+}
+
+func (v *vec[T]) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, escapeHelp(v.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, v.kind)
+}
+
+// Counter is a monotonically increasing value per label set.
+type Counter struct {
+	v *vec[float64]
+}
+
+// NewCounter registers a counter with the given label names.
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{v: newVec(name, help, "counter", labels, func() float64 { return 0 })}
+	r.register(c)
+	return c
+}
+
+// Inc adds 1 to the counter for the label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds delta, which must not be negative, to the counter.
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic(fmt.Sprintf("metrics: カウンター %s を減らすことはできません", c.v.name))
+	}
+	c.v.mu.Lock()
+	defer c.v.mu.Unlock()
+	c.v.with(labelValues).value += delta
+}
+
+// Value returns the current value for the label values.
+func (c *Counter) Value(labelValues ...string) float64 {
+	c.v.mu.Lock()
+	defer c.v.mu.Unlock()
+	if e, ok := c.v.lookup(labelValues); ok {
+		return e.value
+	}
+	return 0
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.v.mu.Lock()
+	defer c.v.mu.Unlock()
+	c.v.writeHeader(w)
+	for _, e := range c.v.sorted() {
+		writeSample(w, c.v.name, c.v.labels, e.values, "", "", e.value)
+	}
+}
+
+// Gauge is a value that can go up and down per label set.
+type Gauge struct {
+	v *vec[float64]
+}
+
+// NewGauge registers a gauge with the given label names.
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{v: newVec(name, help, "gauge", labels, func() float64 { return 0 })}
+	r.register(g)
+	return g
+}
+
+// Set sets the gauge for the label values.
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.v.mu.Lock()
+	defer g.v.mu.Unlock()
+	g.v.with(labelValues).value = value
+}
+
+// Add adds delta, which may be negative, to the gauge.
+func (g *Gauge) Add(delta float64, labelValues ...string) {
+	g.v.mu.Lock()
+	defer g.v.mu.Unlock()
+	g.v.with(labelValues).value += delta
+}
+
+// Value returns the current value for the label values.
+func (g *Gauge) Value(labelValues ...string) float64 {
+	g.v.mu.Lock()
+	defer g.v.mu.Unlock()
+	if e, ok := g.v.lookup(labelValues); ok {
+		return e.value
+	}
+	return 0
+}
+
+func (g *Gauge) write(w *bufio.Writer) {
+	g.v.mu.Lock()
+	defer g.v.mu.Unlock()
+	g.v.writeHeader(w)
+	for _, e := range g.v.sorted() {
+		writeSample(w, g.v.name, g.v.labels, e.values, "", "", e.value)
+	}
+}
+
+// Histogram counts observations in cumulative buckets per label set.
+type Histogram struct {
+	v       *vec[*histogramValue]
+	buckets []float64
+}
+
+type histogramValue struct {
+	counts []uint64 // バケットごとの件数 (累積ではない)
+	sum    float64
+	count  uint64
+}
+
+// NewHistogram registers a histogram with the given upper bounds, which
+// must be sorted in increasing order, and label names.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if !sort.Float64sAreSorted(buckets) {
+		panic(fmt.Sprintf("metrics: %s のバケットが昇順ではありません", name))
+	}
+	h := &Histogram{buckets: buckets}
+	h.v = newVec(name, help, "histogram", labels, func() *histogramValue {
+		return &histogramValue{counts: make([]uint64, len(buckets))}
+	})
+	r.register(h)
+	return h
+}
+
+// Observe records a value for the label values.
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	h.v.mu.Lock()
+	defer h.v.mu.Unlock()
+	hv := h.v.with(labelValues).value
+	if i := sort.SearchFloat64s(h.buckets, value); i < len(h.buckets) {
+		hv.counts[i]++
+	}
+	hv.sum += value
+	hv.count++
+}
+
+// Count returns the number of observations for the label values.
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	h.v.mu.Lock()
+	defer h.v.mu.Unlock()
+	if e, ok := h.v.lookup(labelValues); ok {
+		return e.value.count
+	}
+	return 0
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.v.mu.Lock()
+	defer h.v.mu.Unlock()
+	h.v.writeHeader(w)
+	for _, e := range h.v.sorted() {
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += e.value.counts[i]
+			writeSample(w, h.v.name+"_bucket", h.v.labels, e.values, "le", formatFloat(bound), float64(cumulative))
+		}
+		writeSample(w, h.v.name+"_bucket", h.v.labels, e.values, "le", "+Inf", float64(e.value.count))
+		writeSample(w, h.v.name+"_sum", h.v.labels, e.values, "", "", e.value.sum)
+		writeSample(w, h.v.name+"_count", h.v.labels, e.values, "", "", float64(e.value.count))
+	}
+}
+
+// writeSample writes one line such as name{a="x",le="0.1"} 3.
+func writeSample(w *bufio.Writer, name string, labels, values []string, extraLabel, extraValue string, value float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || extraLabel != "" {
+		w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", label, escapeLabel(values[i]))
+		}
+		if extraLabel != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", extraLabel, extraValue)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+
+// countingWriter は書き込んだバイト数を数えます。
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
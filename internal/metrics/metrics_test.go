@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	r := NewRegistry()
+	notes := r.NewCounter("notes_total", "受信したノートの数", "channel")
+	depth := r.NewGauge("queue_depth", "処理待ちの数")
+	latency := r.NewHistogram("latency_seconds", "所要時間", []float64{0.1, 1}, "endpoint")
+
+	notes.Inc("localTimeline")
+	notes.Add(2, "homeTimeline")
+	notes.Inc(`a"b\c`)
+	depth.Set(3)
+	depth.Add(-1)
+	latency.Observe(0.05, "notes/reactions/create")
+	latency.Observe(0.5, "notes/reactions/create")
+	latency.Observe(3, "notes/reactions/create")
+
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		t.Fatalf("書き出しに失敗しました: %v", err)
+	}
+	expected := `# HELP notes_total 受信したノートの数
+# TYPE notes_total counter
+notes_total{channel="a\"b\\c"} 1
+notes_total{channel="homeTimeline"} 2
+notes_total{channel="localTimeline"} 1
+# HELP queue_depth 処理待ちの数
+# TYPE queue_depth gauge
+queue_depth 2
+# HELP latency_seconds 所要時間
+# TYPE latency_seconds histogram
+latency_seconds_bucket{endpoint="notes/reactions/create",le="0.1"} 1
+latency_seconds_bucket{endpoint="notes/reactions/create",le="1"} 2
+latency_seconds_bucket{endpoint="notes/reactions/create",le="+Inf"} 3
+latency_seconds_sum{endpoint="notes/reactions/create"} 3.55
+latency_seconds_count{endpoint="notes/reactions/create"} 3
+`
+	if buf.String() != expected {
+		t.Errorf("期待値:\n%s\n実際:\n%s", expected, buf.String())
+	}
+}
+
+func TestValue(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("c_total", "c", "rule")
+	h := r.NewHistogram("h_seconds", "h", DefaultBuckets)
+
+	c.Inc("greet")
+	h.Observe(0.2)
+
+	if got := c.Value("greet"); got != 1 {
+		t.Errorf("期待値: 1, 実際: %v", got)
+	}
+	if got := c.Value("unknown"); got != 0 {
+		t.Errorf("期待値: 0, 実際: %v", got)
+	}
+	if got := h.Count(); got != 1 {
+		t.Errorf("期待値: 1, 実際: %v", got)
+	}
+
+	// 値を読んだだけのラベルは出力しない
+	var buf bytes.Buffer
+	r.WriteTo(&buf)
+	if strings.Contains(buf.String(), "unknown") {
+		t.Errorf("読んだだけのラベルが出力されました: %s", buf.String())
+	}
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("c_total", "c").Inc()
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Typeが不正です: %s", ct)
+	}
+	if !strings.Contains(rec.Body.String(), "c_total 1\n") {
+		t.Errorf("レスポンスにメトリクスが含まれていませんでした: %s", rec.Body.String())
+	}
+}
+
+func TestCounter_WrongLabelCount(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("ラベルの数が違う場合はpanicすることを期待しました")
+		}
+	}()
+	NewRegistry().NewCounter("c_total", "c", "rule").Inc()
+}
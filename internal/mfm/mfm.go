@@ -0,0 +1,216 @@
+// Package mfm converts Misskey Flavored Markdown (MFM) into plain text.
+//
+// The conversion is intentionally lenient: anything that does not look like
+// well-formed MFM is kept as literal text, so the output never loses words that
+// the author actually typed.
+package mfm
+
+import (
+	"regexp"
+	"strings"
+
+	"misskey-reaction-cli/internal/emoji"
+)
+
+// Options controls what is kept in the plain-text view.
+type Options struct {
+	// KeepEmoji keeps custom emoji codes such as ":name:" in the output.
+	KeepEmoji bool
+}
+
+// イタリック (*text*) は英数字と空白のみを対象とする (Misskeyの仕様に合わせる)
+var italic = regexp.MustCompile(`^\*([a-zA-Z0-9 ]+)\*`)
+
+// インライン要素として扱うHTML風タグ
+var tags = []string{"small", "center", "plain", "i", "b", "s"}
+
+// PlainText returns the text of src with MFM decorations removed.
+// Function calls ($[tada ...]), bold, italic, strike, tags and links are
+// replaced by their inner text, URLs are dropped and custom emoji codes are
+// dropped unless opts.KeepEmoji is set.
+func PlainText(src string, opts Options) string {
+	p := parser{opts: opts}
+	return strings.TrimSpace(p.inline(stripQuotes(src)))
+}
+
+type parser struct {
+	opts Options
+}
+
+// stripQuotes removes the "> " markers of quote lines.
+func stripQuotes(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		for strings.HasPrefix(line, ">") {
+			line = strings.TrimPrefix(strings.TrimPrefix(line, ">"), " ")
+		}
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (p *parser) inline(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		// 英数字の直後の ":" は時刻などの可能性が高いので絵文字として扱わない
+		if s[i] == ':' && i > 0 && isAlnum(s[i-1]) {
+			b.WriteByte(s[i])
+			i++
+			continue
+		}
+		if n, out, ok := p.token(s[i:]); ok {
+			b.WriteString(out)
+			i += n
+			continue
+		}
+		b.WriteByte(s[i])
+		i++
+	}
+	return b.String()
+}
+
+// token tries to consume one MFM element at the head of s. It returns the
+// number of bytes consumed and the plain text to emit in place of them.
+func (p *parser) token(s string) (int, string, bool) {
+	switch {
+	case strings.HasPrefix(s, "```"):
+		end := strings.Index(s[3:], "```")
+		if end < 0 {
+			return 0, "", false
+		}
+		body := s[3 : 3+end]
+		// 1行目は言語指定なので捨てる
+		if nl := strings.IndexByte(body, '\n'); nl >= 0 {
+			body = body[nl+1:]
+		}
+		return end + 6, strings.TrimSuffix(body, "\n"), true
+	case s[0] == '`':
+		end := strings.IndexAny(s[1:], "`\n")
+		if end < 0 || s[1+end] != '`' {
+			return 0, "", false
+		}
+		return end + 2, s[1 : 1+end], true
+	case strings.HasPrefix(s, "$["):
+		return p.fn(s)
+	case strings.HasPrefix(s, "***"):
+		return p.enclosed(s, "***")
+	case strings.HasPrefix(s, "**"), strings.HasPrefix(s, "__"), strings.HasPrefix(s, "~~"):
+		return p.enclosed(s, s[:2])
+	case s[0] == '*':
+		if m := italic.FindStringSubmatch(s); m != nil {
+			return len(m[0]), m[1], true
+		}
+	case s[0] == '<':
+		return p.tag(s)
+	case s[0] == '[':
+		return p.link(s, 0)
+	case strings.HasPrefix(s, "?["):
+		return p.link(s, 1)
+	case strings.HasPrefix(s, "https://"), strings.HasPrefix(s, "http://"):
+		return urlLen(s), "", true
+	case s[0] == ':':
+		// カスタム絵文字 (:name: / :name@host: / :name@.:)
+		if m := emoji.CustomPrefix(s); m != "" {
+			if p.opts.KeepEmoji {
+				return len(m), m, true
+			}
+			return len(m), "", true
+		}
+	}
+	return 0, "", false
+}
+
+// enclosed handles elements such as **bold** whose start and end markers are
+// the same delimiter.
+func (p *parser) enclosed(s, delim string) (int, string, bool) {
+	end := strings.Index(s[len(delim):], delim)
+	if end <= 0 {
+		return 0, "", false
+	}
+	inner := s[len(delim) : len(delim)+end]
+	return end + 2*len(delim), p.inline(inner), true
+}
+
+// fn handles $[name.args content] and returns the processed content.
+func (p *parser) fn(s string) (int, string, bool) {
+	depth := 0
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				body := s[2:i]
+				sp := strings.IndexAny(body, " \n")
+				if sp < 0 {
+					return i + 1, "", true
+				}
+				return i + 1, p.inline(body[sp+1:]), true
+			}
+		}
+	}
+	return 0, "", false
+}
+
+// tag handles <small>...</small> style elements and <https://...> URLs.
+func (p *parser) tag(s string) (int, string, bool) {
+	if strings.HasPrefix(s, "<https://") || strings.HasPrefix(s, "<http://") {
+		if end := strings.IndexByte(s, '>'); end >= 0 {
+			return end + 1, "", true
+		}
+		return 0, "", false
+	}
+	for _, name := range tags {
+		open, closeTag := "<"+name+">", "</"+name+">"
+		if !strings.HasPrefix(s, open) {
+			continue
+		}
+		end := strings.Index(s[len(open):], closeTag)
+		if end < 0 {
+			return 0, "", false
+		}
+		inner := s[len(open) : len(open)+end]
+		if name != "plain" {
+			inner = p.inline(inner)
+		}
+		return len(open) + end + len(closeTag), inner, true
+	}
+	return 0, "", false
+}
+
+// link handles [label](url) and ?[label](url), returning the label.
+func (p *parser) link(s string, offset int) (int, string, bool) {
+	rest := s[offset:]
+	end := strings.Index(rest, "](")
+	if end < 0 || strings.ContainsAny(rest[:end], "\n") {
+		return 0, "", false
+	}
+	closeParen := strings.IndexByte(rest[end+2:], ')')
+	if closeParen < 0 {
+		return 0, "", false
+	}
+	label := rest[1:end]
+	return offset + end + 2 + closeParen + 1, p.inline(label), true
+}
+
+// urlLen returns the length of the URL at the head of s.
+func urlLen(s string) int {
+	n := 0
+	for n < len(s) && isURLByte(s[n]) {
+		n++
+	}
+	// 文末の句読点はURLに含めない
+	for n > 0 && (s[n-1] == '.' || s[n-1] == ',') {
+		n--
+	}
+	return n
+}
+
+func isURLByte(c byte) bool {
+	return isAlnum(c) || strings.IndexByte(".,_/:%#@$&?!~=+-;", c) >= 0
+}
+
+func isAlnum(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
@@ -0,0 +1,45 @@
+package mfm
+
+import "testing"
+
+func TestPlainText(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		opts     Options
+		expected string
+	}{
+		{"装飾なし", "おはようございます", Options{}, "おはようございます"},
+		{"関数", "$[tada おはよう]ございます", Options{}, "おはようございます"},
+		{"関数_引数付き", "$[spin.speed=2s,alternate くるくる]", Options{}, "くるくる"},
+		{"関数_入れ子", "$[x2 $[tada **すごい**]]", Options{}, "すごい"},
+		{"関数_閉じ括弧なし", "$[tada おはよう", Options{}, "$[tada おはよう"},
+		{"太字", "**おはよう**ございます", Options{}, "おはようございます"},
+		{"太字斜体", "***hello***", Options{}, "hello"},
+		{"斜体", "*hello* world", Options{}, "hello world"},
+		{"打ち消し線", "~~ねむい~~おはよう", Options{}, "ねむいおはよう"},
+		{"タグ", "<small>こっそり</small>おはよう<center>!</center>", Options{}, "こっそりおはよう!"},
+		{"plainタグは中身をそのまま", "<plain>**そのまま**</plain>", Options{}, "**そのまま**"},
+		{"インラインコード", "`code` です", Options{}, "code です"},
+		{"コードブロック", "```go\nfmt.Println()\n```", Options{}, "fmt.Println()"},
+		{"引用", "> 引用です\n本文", Options{}, "引用です\n本文"},
+		{"リンク", "[ここ](https://example.com)を見て", Options{}, "ここを見て"},
+		{"サイレントリンク", "?[ここ](https://example.com)", Options{}, "ここ"},
+		{"URL", "おはよう https://example.com/a?b=c", Options{}, "おはよう"},
+		{"URL_句点", "見て https://example.com/.", Options{}, "見て ."},
+		{"山括弧URL", "<https://example.com/あ>見て", Options{}, "見て"},
+		{"カスタム絵文字を除去", ":wave: おはよう :sun:", Options{}, "おはよう"},
+		{"カスタム絵文字を保持", ":wave: おはよう", Options{KeepEmoji: true}, ":wave: おはよう"},
+		{"リモート絵文字", "おはよう:blobcat@misskey.io:", Options{}, "おはよう"},
+		{"ローカル明示絵文字", "おはよう:blobcat@.:", Options{KeepEmoji: true}, "おはよう:blobcat@.:"},
+		{"コロンだけ", "時刻 12:30:00", Options{}, "時刻 12:30:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PlainText(tt.src, tt.opts); got != tt.expected {
+				t.Errorf("期待値: %q, 実際: %q", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+// Package textnorm normalizes text so that visually equivalent Japanese
+// strings compare equal.
+package textnorm
+
+import (
+	"strings"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Options selects the normalization steps. The steps are applied in the
+// order of the fields.
+type Options struct {
+	// NFKC applies Unicode NFKC normalization (全角英数字→半角, 半角カナ→全角 など)
+	NFKC bool `yaml:"nfkc"`
+	// FoldCase applies Unicode case folding.
+	FoldCase bool `yaml:"fold_case"`
+	// FoldKana converts katakana to hiragana.
+	FoldKana bool `yaml:"fold_kana"`
+	// CollapseSpace trims the text and replaces runs of whitespace, including
+	// the ideographic space, with a single ASCII space.
+	CollapseSpace bool `yaml:"collapse_space"`
+}
+
+// Normalize returns s normalized according to opts.
+func Normalize(s string, opts Options) string {
+	if opts.NFKC {
+		s = norm.NFKC.String(s)
+	}
+	if opts.FoldCase {
+		s = cases.Fold().String(s)
+	}
+	if opts.FoldKana {
+		s = strings.Map(katakanaToHiragana, s)
+	}
+	if opts.CollapseSpace {
+		s = strings.Join(strings.Fields(s), " ")
+	}
+	return s
+}
+
+func katakanaToHiragana(r rune) rune {
+	switch {
+	case 'ァ' <= r && r <= 'ヶ', r == 'ヽ', r == 'ヾ':
+		return r - ('ア' - 'あ')
+	}
+	return r
+}
@@ -0,0 +1,35 @@
+package textnorm
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		opts     Options
+		expected string
+	}{
+		{"オプションなし", "ＡＢＣ　テスト", Options{}, "ＡＢＣ　テスト"},
+		{"NFKC_全角英数字", "ＭｉｓｓＫｅｙ２０２４", Options{NFKC: true}, "MissKey2024"},
+		{"NFKC_半角カナ", "ﾃｽﾄﾉｰﾄ", Options{NFKC: true}, "テストノート"},
+		{"NFKC_濁点付き半角カナ", "ｶﾞｯｺｳ", Options{NFKC: true}, "ガッコウ"},
+		{"NFKC_丸数字", "①", Options{NFKC: true}, "1"},
+		{"大文字小文字", "Hello MISSKEY", Options{FoldCase: true}, "hello misskey"},
+		{"全角大文字をNFKCと大文字小文字で統一", "ＨＥＬＬＯ", Options{NFKC: true, FoldCase: true}, "hello"},
+		{"カタカナをひらがなに", "オハヨウ", Options{FoldKana: true}, "おはよう"},
+		{"小書きと踊り字", "ァヶヽヾ", Options{FoldKana: true}, "ぁゖゝゞ"},
+		{"長音記号はそのまま", "ラーメン", Options{FoldKana: true}, "らーめん"},
+		{"ひらがなはそのまま", "おはよう", Options{FoldKana: true}, "おはよう"},
+		{"半角カナはNFKCとかな統一で", "ｵﾊﾖｳ", Options{NFKC: true, FoldKana: true}, "おはよう"},
+		{"空白の圧縮", "  おはよう　　ございます\n\tみなさん ", Options{CollapseSpace: true}, "おはよう ございます みなさん"},
+		{"全部", "　ＯＨＡＹＯ　ｵﾊﾖｳ　", Options{NFKC: true, FoldCase: true, FoldKana: true, CollapseSpace: true}, "ohayo おはよう"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Normalize(tt.src, tt.opts); got != tt.expected {
+				t.Errorf("期待値: %q, 実際: %q", tt.expected, got)
+			}
+		})
+	}
+}